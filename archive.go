@@ -0,0 +1,215 @@
+package logger
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ManifestName 压缩文件所在目录中记录压缩文件SHA-256的清单，格式与sha256sum相同，可以使用 sha256sum -c SHA256SUMS 校验
+const ManifestName = "SHA256SUMS"
+
+// 压缩文件的校验错误
+var (
+	ErrArchiveMissing   = errors.New("archive missing")   // 清单中的压缩文件不存在
+	ErrChecksumMismatch = errors.New("checksum mismatch") // SHA-256与清单不一致
+)
+
+// ArchiveStatus 一个压缩文件的校验结果
+type ArchiveStatus struct {
+	Path     string // 压缩文件
+	Unlisted bool   // 不在清单中，例如增加SHA256SUMS之前的压缩文件，只检查了CRC
+	Err      error  // 为nil时校验通过
+}
+
+// VerifyArchives 校验日志目录中所有的压缩文件
+// 检查压缩文件的SHA-256与所在目录的SHA256SUMS一致，并且压缩文件中每个文件的CRC正确
+// 不在清单中的压缩文件只检查CRC，ArchiveStatus.Unlisted为true
+// 加密的压缩文件需要SetArchiveKeys设置密钥后才检查CRC，否则只检查SHA-256
+// 返回每个压缩文件的校验结果，error只表示遍历日志目录失败
+func VerifyArchives(root string) ([]ArchiveStatus, error) {
+	manifests := map[string]map[string]string{}
+	var archives []string
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		switch {
+		case info.Name() == ManifestName:
+			sums, err := readManifest(p)
+			if err != nil {
+				return err
+			}
+			manifests[filepath.Dir(p)] = sums
+		case isArchive(info.Name()):
+			archives = append(archives, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var result []ArchiveStatus
+	for _, p := range archives {
+		sum, ok := manifests[filepath.Dir(p)][filepath.Base(p)]
+		result = append(result, ArchiveStatus{Path: p, Unlisted: !ok, Err: verifyArchive(p, sum)})
+	}
+	for dir, sums := range manifests {
+		for name := range sums {
+			p := filepath.Join(dir, name)
+			if _, err := os.Lstat(p); os.IsNotExist(err) {
+				result = append(result, ArchiveStatus{Path: p, Err: ErrArchiveMissing})
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Path < result[j].Path })
+	return result, nil
+}
+
+// verifyArchive 校验压缩文件的SHA-256和其中每个文件的CRC，sum为空时(不在清单中)只检查CRC
+func verifyArchive(p string, sum string) error {
+	if sum != "" {
+		if s, err := fileSHA256(p); err != nil {
+			return err
+		} else if s != sum {
+			return ErrChecksumMismatch
+		}
+	}
+	kp := getArchiveKeys()
+	if strings.HasSuffix(p, EncryptedExt) && kp == nil {
+		return nil
+	}
+	return verifyZip(p, kp, nil)
+}
+
+// verifyZip 读出压缩文件中所有的文件，CRC错误时返回zip.ErrChecksum，加密的压缩文件使用kp解密
+// sums不为nil时还要求压缩文件中的文件与sums一一对应且SHA-256一致
+func verifyZip(zipFile string, kp KeyProvider, sums map[string]string) error {
+	zr, c, err := openArchiveWith(zipFile, kp)
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	if sums != nil && len(zr.File) != len(sums) {
+		return fmt.Errorf("%s: %d files, want %d", zipFile, len(zr.File), len(sums))
+	}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		h := sha256.New()
+		_, err = io.Copy(h, rc)
+		rc.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %s: %v", zipFile, f.Name, err)
+		}
+		if sums != nil && sums[f.Name] != hex.EncodeToString(h.Sum(nil)) {
+			return fmt.Errorf("%s: %s: %v", zipFile, f.Name, ErrChecksumMismatch)
+		}
+	}
+	return nil
+}
+
+func fileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// readManifest 读取SHA256SUMS，返回文件名到SHA-256的映射
+func readManifest(p string) (map[string]string, error) {
+	sums := map[string]string{}
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return sums, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		line := s.Text()
+		// sha256sum的格式：<sha256>  <name>，二进制模式为<sha256> *<name>
+		if len(line) < 66 || line[64] != ' ' {
+			continue
+		}
+		sums[strings.TrimPrefix(line[66:], "*")] = line[:64]
+	}
+	return sums, s.Err()
+}
+
+// updateManifest 修改压缩文件所在目录的SHA256SUMS，sum为空时删除记录
+// 写入临时文件后rename，清单不会只写入一半
+func updateManifest(zipFile, sum string) error {
+	p := filepath.Join(filepath.Dir(zipFile), ManifestName)
+	sums, err := readManifest(p)
+	if err != nil {
+		return err
+	}
+	name := filepath.Base(zipFile)
+	if sum == "" {
+		if _, ok := sums[name]; !ok {
+			return nil
+		}
+		delete(sums, name)
+	} else {
+		sums[name] = sum
+	}
+
+	names := make([]string, 0, len(sums))
+	for name := range sums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(sums[name] + "  " + name + "\n")
+	}
+	tmp := p + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(b.String()), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, p); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// addManifest 把压缩文件的SHA-256写入所在目录的SHA256SUMS
+func addManifest(zipFile string) error {
+	sum, err := fileSHA256(zipFile)
+	if err != nil {
+		return err
+	}
+	return updateManifest(zipFile, sum)
+}
+
+// removeArchive 删除过期的压缩文件和SHA256SUMS中的记录
+func removeArchive(zipFile string) error {
+	if err := os.RemoveAll(zipFile); err != nil {
+		return err
+	}
+	return updateManifest(zipFile, "")
+}
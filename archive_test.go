@@ -0,0 +1,108 @@
+package logger
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// go test -run TestVerifyArchives -v -count=1
+func TestVerifyArchives(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	month := filepath.Join(dir, "2019", "02")
+	os.MkdirAll(month, 0755)
+	for _, day := range []string{"01", "02", "03"} {
+		ioutil.WriteFile(filepath.Join(month, "2019-02-"+day+".log"), []byte("2019-02-"+day+"\n"), 0644)
+		if err := compressAndRemoveFile(filepath.Join(month, "2019-02-"+day+".log"), filepath.Join(month, "2019-02-"+day+".zip")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 校验后写入SHA256SUMS
+	bs, _ := ioutil.ReadFile(filepath.Join(month, ManifestName))
+	if lines := strings.Split(strings.TrimSpace(string(bs)), "\n"); len(lines) != 3 || !strings.HasSuffix(lines[0], "  2019-02-01.zip") {
+		t.Fatal(string(bs))
+	}
+	result, err := VerifyArchives(dir)
+	if err != nil || len(result) != 3 {
+		t.Fatal(result, err)
+	}
+	for _, r := range result {
+		if r.Err != nil {
+			t.Fatal(r.Path, r.Err)
+		}
+	}
+
+	// 损坏、删除和不在清单中的压缩文件
+	bs, _ = ioutil.ReadFile(filepath.Join(month, "2019-02-01.zip"))
+	bs[len(bs)/2] ^= 0xff
+	ioutil.WriteFile(filepath.Join(month, "2019-02-01.zip"), bs, 0644)
+	os.Remove(filepath.Join(month, "2019-02-02.zip"))
+	old := filepath.Join(dir, "2019", "2019-01.zip")
+	fz, _ := os.Create(old)
+	zw := zip.NewWriter(fz)
+	fw, _ := zw.Create("2019-01-01.log")
+	fw.Write([]byte("2019-01-01\n"))
+	zw.Close()
+	fz.Close()
+	result, _ = VerifyArchives(dir)
+	want := map[string]error{
+		old:                                    nil,
+		filepath.Join(month, "2019-02-01.zip"): ErrChecksumMismatch,
+		filepath.Join(month, "2019-02-02.zip"): ErrArchiveMissing,
+		filepath.Join(month, "2019-02-03.zip"): nil,
+	}
+	if len(result) != len(want) {
+		t.Fatal(result)
+	}
+	for _, r := range result {
+		if e, ok := want[r.Path]; !ok || e != r.Err || r.Unlisted != (r.Path == old) {
+			t.Fatal(r.Path, r.Err, r.Unlisted)
+		}
+	}
+
+	// 不在清单中的压缩文件也检查CRC
+	ioutil.WriteFile(old, nil, 0644)
+	result, _ = VerifyArchives(dir)
+	for _, r := range result {
+		if r.Path == old && (!r.Unlisted || r.Err == nil) {
+			t.Fatal(r)
+		}
+	}
+
+	// 删除过期压缩文件时删除清单中的记录
+	if err := removeArchive(filepath.Join(month, "2019-02-03.zip")); err != nil {
+		t.Fatal(err)
+	}
+	if sums, _ := readManifest(filepath.Join(month, ManifestName)); len(sums) != 2 {
+		t.Fatal(sums)
+	}
+}
+
+// go test -run TestVerifyZip -v -count=1
+func TestVerifyZip(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "a.log")
+	ioutil.WriteFile(file, []byte("hello\n"), 0644)
+
+	sums := map[string]string{}
+	if err := writeZip(filepath.Join(dir, "a.zip"), nil, []string{file}, dir, sums); err != nil {
+		t.Fatal(err)
+	}
+	if err := verifyZip(filepath.Join(dir, "a.zip"), nil, sums); err != nil {
+		t.Fatal(err)
+	}
+	sums["a.log"] = strings.Repeat("0", 64)
+	if err := verifyZip(filepath.Join(dir, "a.zip"), nil, sums); err == nil {
+		t.Fatal("checksum not verified")
+	}
+	sums["b.log"] = strings.Repeat("0", 64)
+	if err := verifyZip(filepath.Join(dir, "a.zip"), nil, sums); err == nil {
+		t.Fatal("missing file not detected")
+	}
+}
@@ -0,0 +1,418 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ohko/logger/parser"
+)
+
+// 审计日志模式下每条日志末尾增加链式哈希，每个日志文件的第一行记录上一个文件最后的哈希
+//
+//	# logger audit chain prev=<上一个文件最后的哈希>
+//	2019/02/02 10:00:01 /src/a.go:12: [api:W]message chain=<SHA-256(prev || 日志内容)>
+//
+// 修改、删除或插入日志都会导致之后的哈希不一致，设置AuditKey时使用HMAC-SHA256，没有密钥无法重新计算整条链
+// 每个Path/Label目录是一条审计链，链头保存在目录中的.logger.audit，重启或logrotate切割后从这里继续
+// 只有写入日志目录的日志加入审计链，降级时写入FallbackPath和os.Stderr的日志不在审计链中，
+// 内存环形缓存中的日志恢复后逐行加入审计链，溢出丢弃的日志也不在审计链中
+const (
+	auditMarker    = parser.AuditMarker
+	auditSuffix    = parser.AuditSuffix
+	auditStateName = ".logger.audit"
+)
+
+// auditChain 当前的链头
+type auditChain struct {
+	key   []byte
+	head  []byte   // 最后一条日志的哈希，nil表示审计链的开始
+	state *os.File // 保存链头的.logger.audit，加排他锁，同一个Label只有一个DefaultWriter写审计链
+}
+
+// openAuditState 打开Label目录的.logger.audit并加排他锁，返回保存的链头
+// 其它进程或同一个Label的其它DefaultWriter已经在写审计链时返回错误，windows不检查
+func openAuditState(dir string) (*os.File, []byte, error) {
+	os.MkdirAll(dir, 0755)
+	f, err := os.OpenFile(filepath.Join(dir, auditStateName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !tryLock(f) {
+		f.Close()
+		return nil, nil, errors.New(dir + ": audit chain is used by another writer")
+	}
+	return f, parseAuditState(f), nil
+}
+
+// readAuditState 读取.logger.audit中保存的链头，还没有写过日志时为nil
+func readAuditState(name string) ([]byte, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseAuditState(f), nil
+}
+
+func parseAuditState(r io.Reader) []byte {
+	buf := make([]byte, 2*sha256.Size)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil
+	}
+	head, err := hex.DecodeString(string(buf))
+	if err != nil {
+		return nil
+	}
+	return head
+}
+
+func newAuditHash(key []byte) hash.Hash {
+	if len(key) > 0 {
+		return hmac.New(sha256.New, key)
+	}
+	return sha256.New()
+}
+
+// auditSum 计算一条日志的哈希，body不包含chain=和最后的换行
+func auditSum(key, prev, body []byte) []byte {
+	h := newAuditHash(key)
+	h.Write(prev)
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+func (c *auditChain) prev() []byte {
+	if c.head == nil {
+		return make([]byte, sha256.Size)
+	}
+	return c.head
+}
+
+// seal 在日志末尾增加哈希，返回新的链头，写入成功后调用commit
+func (c *auditChain) seal(p []byte) ([]byte, []byte) {
+	body := bytes.TrimSuffix(p, []byte("\n"))
+	head := auditSum(c.key, c.prev(), body)
+	out := make([]byte, 0, len(body)+len(auditSuffix)+2*sha256.Size+1)
+	out = append(out, body...)
+	out = append(out, auditSuffix...)
+	out = append(out, hex.EncodeToString(head)...)
+	return append(out, '\n'), head
+}
+
+// sealLines 逐行增加哈希，用于补写内存环形缓存中的日志
+func (c *auditChain) sealLines(p []byte) ([]byte, []byte) {
+	var out []byte
+	saved := c.head
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		data, head := c.seal(line)
+		out = append(out, data...)
+		c.head = head
+	}
+	head := c.head
+	c.head = saved
+	return out, head
+}
+
+// commit 日志写入成功后更新链头并保存到.logger.audit
+func (c *auditChain) commit(head []byte) error {
+	c.head = head
+	if c.state == nil {
+		return nil
+	}
+	_, err := c.state.WriteAt([]byte(hex.EncodeToString(head)+"\n"), 0)
+	return err
+}
+
+// marker 新日志文件的第一行
+func (c *auditChain) marker() []byte {
+	return []byte(auditMarker + hex.EncodeToString(c.prev()) + "\n")
+}
+
+// parseAuditLine 返回哈希行中的日志内容和哈希，或标记行中上一个文件的哈希
+func parseAuditLine(line string) (body string, sum []byte, marker bool) {
+	if strings.HasPrefix(line, auditMarker) {
+		if sum, err := hex.DecodeString(line[len(auditMarker):]); err == nil && len(sum) == sha256.Size {
+			return "", sum, true
+		}
+		return "", nil, false
+	}
+	i := len(line) - len(auditSuffix) - 2*sha256.Size
+	if i < 0 || line[i:i+len(auditSuffix)] != auditSuffix {
+		return "", nil, false
+	}
+	sum, err := hex.DecodeString(line[i+len(auditSuffix):])
+	if err != nil {
+		return "", nil, false
+	}
+	return line[:i], sum, false
+}
+
+// lastAuditHead 读取日志文件最后一行的哈希，用于重启后继续审计链
+// 只需要最后一行的结尾，很长的最后一行只读到一部分也可以解析
+func lastAuditHead(f string) []byte {
+	fp, err := os.Open(f)
+	if err != nil {
+		return nil
+	}
+	defer fp.Close()
+	fi, err := fp.Stat()
+	if err != nil {
+		return nil
+	}
+	n := int64(4096)
+	if fi.Size() < n {
+		n = fi.Size()
+	}
+	buf := make([]byte, n)
+	if _, err := fp.ReadAt(buf, fi.Size()-n); err != nil {
+		return nil
+	}
+	s := strings.TrimSuffix(string(buf), "\n")
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		s = s[i+1:]
+	}
+	_, sum, _ := parseAuditLine(s)
+	return sum
+}
+
+// AuditBreak 审计链第一个断开的位置
+type AuditBreak struct {
+	File   string // 相对日志目录的文件路径
+	Entry  string // zip压缩包内的文件
+	Line   int    // 行号，从1开始
+	Reason string // 原因
+}
+
+func (e *AuditBreak) Error() string {
+	file := e.File
+	if e.Entry != "" {
+		file += ":" + e.Entry
+	}
+	return fmt.Sprintf("audit chain broken at %s:%d: %s", file, e.Line, e.Reason)
+}
+
+// AuditVerifyOption 审计链的校验参数
+type AuditVerifyOption struct {
+	Key   []byte // DefaultWriterOption.AuditKey
+	Start []byte // 删除过期日志后保留的最早的日志文件的prev，应从外部保存的记录获取，默认只接受从全0开始的审计链
+}
+
+// VerifyAudit 校验日志目录中所有日志文件和压缩包的审计链
+// 每个文件第一行的prev必须是另一个文件最后的哈希，或者是审计链的开始(全0或AuditVerifyOption.Start)，
+// 日志目录中可以有多个Label的审计链
+// 返回校验的日志条数和第一个断开的位置，审计链完整时AuditBreak为nil
+// 只校验.log扩展名的日志文件和压缩包，最后的哈希还要与.logger.audit中保存的链头一致，
+// 同时删除.logger.audit和最后一个文件末尾的日志时需要与外部保存的链头比较
+func VerifyAudit(root string, option *AuditVerifyOption) (int, *AuditBreak, error) {
+	if option == nil {
+		option = &AuditVerifyOption{}
+	}
+	type source struct {
+		file, entry string
+		start       time.Time
+		prev, last  string
+	}
+	var sources []*source
+	heads := map[string]string{} // .logger.audit中保存的链头
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.Name() == auditStateName {
+			if head, err := readAuditState(p); err != nil {
+				return err
+			} else if head != nil {
+				heads[rel] = hex.EncodeToString(head)
+			}
+			return nil
+		}
+		if strings.HasPrefix(info.Name(), ".") {
+			return nil
+		}
+		switch {
+		case strings.HasSuffix(rel, ".log"):
+			start, _, _ := logFileRange(rel, false, time.Local)
+			sources = append(sources, &source{file: rel, start: start})
+		case isArchive(rel):
+			entries, err := zipEntries(root, rel)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				start, _, _ := logFileRange(entry, false, time.Local)
+				sources = append(sources, &source{file: rel, entry: entry, start: start})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	sort.SliceStable(sources, func(i, j int) bool {
+		if !sources[i].start.Equal(sources[j].start) {
+			return sources[i].start.Before(sources[j].start)
+		}
+		return naturalLess(sources[i].file+"/"+sources[i].entry, sources[j].file+"/"+sources[j].entry)
+	})
+
+	// 校验每个文件内的哈希
+	total := 0
+	var chained []*source
+	for _, s := range sources {
+		rc, err := OpenLogFile(root, s.file, s.entry)
+		if err != nil {
+			return total, nil, err
+		}
+		prev, last, n, line, reason, err := verifyAuditReader(rc, option.Key)
+		rc.Close()
+		total += n
+		if err != nil {
+			return total, nil, err
+		}
+		if reason != "" {
+			return total, &AuditBreak{File: s.file, Entry: s.entry, Line: line, Reason: reason}, nil
+		}
+		// 空文件不在审计链中
+		if prev != nil {
+			s.prev, s.last = hex.EncodeToString(prev), hex.EncodeToString(last)
+			chained = append(chained, s)
+		}
+	}
+
+	// 连接文件，每个文件最后的哈希只能被一个文件继续，不依赖文件的排序
+	zero := hex.EncodeToString(make([]byte, sha256.Size))
+	tails := map[string]int{}
+	if option.Start != nil {
+		tails[hex.EncodeToString(option.Start)]++
+	}
+	for len(chained) > 0 {
+		var rest []*source
+		for _, s := range chained {
+			switch {
+			case s.prev == zero:
+			case tails[s.prev] > 0:
+				tails[s.prev]--
+			default:
+				rest = append(rest, s)
+				continue
+			}
+			tails[s.last]++
+		}
+		if len(rest) == len(chained) {
+			s := rest[0]
+			return total, &AuditBreak{File: s.file, Entry: s.entry, Line: 1, Reason: "does not continue from previous file"}, nil
+		}
+		chained = rest
+	}
+
+	// 最后的哈希必须是.logger.audit中的链头，删除最新文件末尾的日志时不一致
+	var states []string
+	for rel := range heads {
+		states = append(states, rel)
+	}
+	sort.Strings(states)
+	for _, rel := range states {
+		if tails[heads[rel]] == 0 {
+			return total, &AuditBreak{File: rel, Line: 1, Reason: "last entry does not match saved chain head"}, nil
+		}
+		tails[heads[rel]]--
+	}
+	return total, nil, nil
+}
+
+// verifyAuditReader 校验一个日志文件，返回第一行的prev、最后的哈希和校验的日志条数，断开时返回行号和原因
+// 空文件返回的prev为nil
+func verifyAuditReader(r io.Reader, key []byte) ([]byte, []byte, int, int, string, error) {
+	br := bufio.NewReader(r)
+	var prev, cur []byte
+	var pending []string
+	entries, lineNo := 0, 0
+	for {
+		s, err := br.ReadString('\n')
+		if s == "" && err == io.EOF {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return nil, nil, entries, lineNo, "", err
+		}
+		lineNo++
+		line := strings.TrimSuffix(s, "\n")
+		body, sum, marker := parseAuditLine(line)
+		switch {
+		case cur == nil && !marker:
+			return nil, nil, entries, lineNo, "missing chain marker", nil
+		case marker && cur != nil:
+			return nil, nil, entries, lineNo, "unexpected chain marker", nil
+		case marker:
+			prev, cur = sum, sum
+		case sum == nil:
+			// 多行日志的前几行
+			pending = append(pending, line)
+		default:
+			pending = append(pending, body)
+			if !hmac.Equal(auditSum(key, cur, []byte(strings.Join(pending, "\n"))), sum) {
+				return nil, nil, entries, lineNo, "hash mismatch", nil
+			}
+			cur, pending = sum, pending[:0]
+			entries++
+		}
+	}
+	if len(pending) > 0 {
+		return nil, nil, entries, lineNo, "unchained lines at end of file", nil
+	}
+	return prev, cur, entries, 0, "", nil
+}
+
+// naturalLess 数字按大小比较，api.2.log排在api.10.log前面
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		da, db := leadingDigits(a), leadingDigits(b)
+		if da != "" && db != "" {
+			na, nb := strings.TrimLeft(da, "0"), strings.TrimLeft(db, "0")
+			if len(na) != len(nb) {
+				return len(na) < len(nb)
+			}
+			if na != nb {
+				return na < nb
+			}
+			a, b = a[len(da):], b[len(db):]
+			continue
+		}
+		if a[0] != b[0] {
+			return a[0] < b[0]
+		}
+		a, b = a[1:], b[1:]
+	}
+	return len(a) < len(b)
+}
+
+func leadingDigits(s string) string {
+	i := 0
+	for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+		i++
+	}
+	return s[:i]
+}
@@ -0,0 +1,209 @@
+package logger
+
+import (
+	"archive/zip"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ohko/logger/clock/clocktest"
+)
+
+// go test -run TestAuditChain -v -count=1
+func TestAuditChain(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	key := &AuditVerifyOption{Key: []byte("audit key")}
+
+	// 每次重启使用新的clock，旧的DefaultWriter不再切换日志文件，关闭.logger.audit模拟进程退出
+	start := time.Date(2019, 2, 10, 23, 0, 0, 0, time.UTC)
+	var w *DefaultWriter
+	open := func(c *clocktest.Clock) *Logger {
+		if w != nil {
+			w.audit.state.Close()
+		}
+		w = NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: "api_", Audit: true, AuditKey: key.Key, Location: time.UTC, Clock: c}).(*DefaultWriter)
+		l := NewLogger(w)
+		l.SetClock(c)
+		return l
+	}
+	l := open(clocktest.New(start))
+	l.Log1Warn("first")
+	l.Log2Error("multi\nline")
+
+	// 重启后从日志文件的最后一行继续
+	c := clocktest.New(start)
+	l = open(c)
+	l.Log1Warn("after restart")
+
+	// 切换日志文件时链头写入新文件
+	c.BlockUntil(1)
+	c.Add(time.Hour)
+	c.BlockUntil(2)
+	l.Log1Warn("next day")
+
+	// 重启后从.logger.audit继续，不使用其它Name也会修改的CurrentLink
+	root := filepath.Join(dir, "app")
+	os.Remove(filepath.Join(root, "current.log"))
+	os.Symlink("other.log", filepath.Join(root, "current.log"))
+	l = open(clocktest.New(start.Add(25 * time.Hour)))
+	l.Log1Warn("day after restart")
+
+	day10 := filepath.Join(root, "2019", "02", "api_2019-02-10.log")
+	if bs, _ := ioutil.ReadFile(day10); !strings.HasPrefix(string(bs), auditMarker+strings.Repeat("0", 64)+"\n") {
+		t.Fatal(string(bs))
+	}
+	if n, brk, err := VerifyAudit(root, key); err != nil || brk != nil || n != 5 {
+		t.Fatal(n, brk, err)
+	}
+	if _, brk, _ := VerifyAudit(root, &AuditVerifyOption{Key: []byte("wrong")}); brk == nil || brk.Line != 2 || brk.Reason != "hash mismatch" {
+		t.Fatal(brk)
+	}
+
+	// 查询结果中没有链头和哈希
+	var messages []string
+	Query(root, nil, func(l *QueryLine) error {
+		messages = append(messages, l.Message)
+		if strings.Contains(l.Text, auditSuffix) {
+			t.Fatal(l.Text)
+		}
+		return nil
+	})
+	if strings.Join(messages, ",") != "first,multi\nline,after restart,next day,day after restart" {
+		t.Fatal(messages)
+	}
+
+	// 压缩后按时间顺序校验压缩包，第一个DefaultWriter还持有文件锁，直接写入压缩包
+	bs, _ := ioutil.ReadFile(day10)
+	zf, _ := os.Create(strings.TrimSuffix(day10, ".log") + ".zip")
+	zw := zip.NewWriter(zf)
+	fw, _ := zw.Create(filepath.Base(day10))
+	fw.Write(bs)
+	zw.Close()
+	zf.Close()
+	os.Remove(day10)
+	if n, brk, err := VerifyAudit(root, key); err != nil || brk != nil || n != 5 {
+		t.Fatal(n, brk, err)
+	}
+
+	// 修改、删除日志或删除文件末尾的日志
+	day11 := filepath.Join(root, "2019", "02", "api_2019-02-11.log")
+	orig, _ := ioutil.ReadFile(day11)
+	lines := strings.SplitAfter(string(orig), "\n")
+	for _, c := range []struct {
+		file, content string
+		want          AuditBreak
+	}{
+		{day11, strings.Replace(string(orig), "next day", "next dax", 1), AuditBreak{File: "2019/02/api_2019-02-11.log", Line: 2, Reason: "hash mismatch"}},
+		{day11, lines[0], AuditBreak{File: "2019/02/api_2019-02-12.log", Line: 1, Reason: "does not continue from previous file"}},
+		{day11, string(orig) + "forged\n", AuditBreak{File: "2019/02/api_2019-02-11.log", Line: 3, Reason: "unchained lines at end of file"}},
+		{day11, lines[1], AuditBreak{File: "2019/02/api_2019-02-11.log", Line: 1, Reason: "missing chain marker"}},
+	} {
+		ioutil.WriteFile(c.file, []byte(c.content), 0644)
+		if _, brk, err := VerifyAudit(root, key); err != nil || brk == nil || *brk != c.want {
+			t.Fatal(brk, err)
+		}
+		ioutil.WriteFile(c.file, orig, 0644)
+	}
+	if _, brk, _ := VerifyAudit(root, key); brk != nil {
+		t.Fatal(brk)
+	}
+
+	// 删除最新文件末尾的日志时与.logger.audit中的链头不一致
+	day12 := filepath.Join(root, "2019", "02", "api_2019-02-12.log")
+	orig, _ = ioutil.ReadFile(day12)
+	ioutil.WriteFile(day12, []byte(strings.SplitAfter(string(orig), "\n")[0]), 0644)
+	if _, brk, _ := VerifyAudit(root, key); brk == nil || brk.File != auditStateName || brk.Reason != "last entry does not match saved chain head" {
+		t.Fatal(brk)
+	}
+	ioutil.WriteFile(day12, orig, 0644)
+
+	// 删除最早的日志后需要指定保留的第一个文件的prev
+	os.Remove(strings.TrimSuffix(day10, ".log") + ".zip")
+	if _, brk, _ := VerifyAudit(root, key); brk == nil || brk.File != "2019/02/api_2019-02-11.log" || brk.Line != 1 {
+		t.Fatal(brk)
+	}
+	prev, _ := hex.DecodeString(strings.TrimPrefix(strings.TrimSpace(lines[0]), auditMarker))
+	if n, brk, err := VerifyAudit(root, &AuditVerifyOption{Key: key.Key, Start: prev}); err != nil || brk != nil || n != 2 {
+		t.Fatal(n, brk, err)
+	}
+	os.Remove(day11)
+	if _, brk, _ := VerifyAudit(root, &AuditVerifyOption{Key: key.Key, Start: prev}); brk == nil || brk.File != "2019/02/api_2019-02-12.log" {
+		t.Fatal(brk)
+	}
+}
+
+// go test -run TestAuditFixedName -v -count=1
+func TestAuditFixedName(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+
+	w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: "api", FixedName: true, Audit: true}).(*DefaultWriter)
+	l := NewLogger(w)
+	file := filepath.Join(dir, "app", "api.log")
+	l.Log1Warn("before rotate")
+
+	// logrotate切割后保留.log扩展名才能校验
+	os.Rename(file, filepath.Join(dir, "app", "api-1.log"))
+	w.Reopen()
+	l.Log1Warn("after reopen")
+
+	// 切割后重启，新文件从.logger.audit继续而不是从全0开始
+	w.audit.state.Close()
+	os.Rename(file, filepath.Join(dir, "app", "api-2.log"))
+	l = NewLogger(NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: "api", FixedName: true, Audit: true}))
+	l.Log1Warn("after restart")
+
+	prev := hex.EncodeToString(lastAuditHead(filepath.Join(dir, "app", "api-2.log")))
+	cur, _ := ioutil.ReadFile(file)
+	if !strings.HasPrefix(string(cur), auditMarker+prev+"\n") || prev == strings.Repeat("0", 64) {
+		t.Fatal(prev, string(cur))
+	}
+	if n, brk, err := VerifyAudit(filepath.Join(dir, "app"), nil); err != nil || brk != nil || n != 3 {
+		t.Fatal(n, brk, err)
+	}
+}
+
+// go test -run TestAuditFallback -v -count=1
+func TestAuditFallback(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	blocked := filepath.Join(dir, "blocked")
+	ioutil.WriteFile(blocked, nil, 0644)
+
+	// FallbackPath中的日志不在审计链中
+	w := NewDefaultWriter(&DefaultWriterOption{Path: blocked, FallbackPath: filepath.Join(dir, "fallback"), Audit: true, ErrorHandler: func(*LoggerError) {}})
+	NewLogger(w).Log1Warn("to fallback")
+	bs, _ := ioutil.ReadFile(filepath.Join(dir, "fallback", time.Now().Format("2006/01/2006-01-02.log")))
+	if s := string(bs); !strings.Contains(s, "to fallback") || strings.Contains(s, auditSuffix) {
+		t.Fatal(s)
+	}
+
+	// 内存环形缓存中的日志恢复后逐行加入审计链
+	os.RemoveAll(filepath.Join(dir, "fallback"))
+	mw := NewDefaultWriter(&DefaultWriterOption{Path: blocked, NoStderrFallback: true, RetryInterval: time.Millisecond * 10, Audit: true, ErrorHandler: func(*LoggerError) {}}).(*DefaultWriter)
+	l := NewLogger(mw)
+	l.Log1Warn("in memory")
+	l.Log2Error("multi\nline")
+	os.Remove(blocked)
+	time.Sleep(time.Millisecond * 20)
+	l.Log1Warn("recovered")
+	if mw.State() != WriterStatePrimary {
+		t.Fatal(mw.State())
+	}
+	if n, brk, err := VerifyAudit(blocked, nil); err != nil || brk != nil || n != 4 {
+		t.Fatal(n, brk, err)
+	}
+}
+
+func TestNaturalLess(t *testing.T) {
+	for _, c := range [][2]string{{"api.2.log", "api.10.log"}, {"a", "b"}, {"a1", "a01x"}, {"2019/01", "2019/02"}} {
+		if !naturalLess(c[0], c[1]) || naturalLess(c[1], c[0]) {
+			t.Fatal(c)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ohko/logger/parser"
+)
+
+// sinkEntry 发送到日志服务的日志
+type sinkEntry struct {
+	*parser.Entry
+	Time time.Time // 写入时间
+}
+
+// newSinkEntry 解析Logger的一条日志
+func newSinkEntry(p []byte) *sinkEntry {
+	text := string(p)
+	e, err := parser.ParseLine(text)
+	if err != nil {
+		e = &parser.Entry{Level: parser.LevelNormal, Message: parser.StripColor(strings.TrimSuffix(text, "\n")), Raw: text}
+	}
+	return &sinkEntry{Entry: e, Time: time.Now()}
+}
+
+// line 去掉颜色和换行的日志原文
+func (o *sinkEntry) line() string {
+	return parser.StripColor(strings.TrimSuffix(o.Raw, "\n"))
+}
+
+// errBatchFull 发送队列已满
+var errBatchFull = errors.New("batch queue full")
+
+// batcher 按条数或时间间隔批量发送日志
+type batcher struct {
+	size    int
+	wait    time.Duration
+	max     int
+	push    func([]*sinkEntry) error
+	onError func(error)
+
+	lock    sync.Mutex
+	entries []*sinkEntry
+	notify  chan struct{}
+	closed  bool
+	done    chan struct{}
+}
+
+func newBatcher(size int, wait time.Duration, max int, push func([]*sinkEntry) error) *batcher {
+	o := &batcher{size: size, wait: wait, max: max, push: push, notify: make(chan struct{}, 1), done: make(chan struct{})}
+	go o.backend()
+	return o
+}
+
+func (o *batcher) add(e *sinkEntry) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.closed {
+		return io.ErrClosedPipe
+	}
+	if len(o.entries) >= o.max {
+		return errBatchFull
+	}
+	o.entries = append(o.entries, e)
+	if len(o.entries) >= o.size {
+		select {
+		case o.notify <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+func (o *batcher) take(all bool) []*sinkEntry {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	n := len(o.entries)
+	if n > o.size {
+		n = o.size
+	}
+	if n == 0 || (!all && n < o.size) {
+		return nil
+	}
+	batch := o.entries[:n:n]
+	o.entries = o.entries[n:]
+	return batch
+}
+
+func (o *batcher) backend() {
+	defer close(o.done)
+	t := time.NewTicker(o.wait)
+	defer t.Stop()
+	for {
+		all := false
+		select {
+		case <-o.notify:
+		case <-t.C:
+			all = true
+		}
+
+		o.lock.Lock()
+		closed := o.closed
+		o.lock.Unlock()
+		if closed {
+			all = true
+		}
+
+		for {
+			batch := o.take(all)
+			if batch == nil {
+				break
+			}
+			if err := o.push(batch); err != nil && o.onError != nil {
+				o.onError(err)
+			}
+		}
+		if closed {
+			return
+		}
+	}
+}
+
+// close 发送剩余的日志后停止
+func (o *batcher) close() {
+	o.lock.Lock()
+	if o.closed {
+		o.lock.Unlock()
+		return
+	}
+	o.closed = true
+	o.lock.Unlock()
+	select {
+	case o.notify <- struct{}{}:
+	default:
+	}
+	<-o.done
+}
+
+// retryOption 失败重试设置
+type retryOption struct {
+	MaxRetries int           // 最大重试次数
+	MinBackoff time.Duration // 第一次重试的等待时间，之后每次翻倍
+	MaxBackoff time.Duration // 最长等待时间
+}
+
+// retry fn返回是否可以重试和错误
+func retry(o retryOption, fn func() (bool, error)) error {
+	backoff := o.MinBackoff
+	for i := 0; ; i++ {
+		retryable, err := fn()
+		if err == nil || !retryable || i >= o.MaxRetries {
+			return err
+		}
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > o.MaxBackoff {
+			backoff = o.MaxBackoff
+		}
+	}
+}
+
+// httpDo 发送HTTP请求，网络错误、429和5xx可以重试
+func httpDo(client *http.Client, req *http.Request) (*http.Response, bool, error) {
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	if res.StatusCode/100 == 2 {
+		return res, false, nil
+	}
+	bs, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	res.Body.Close()
+	err = fmt.Errorf("%s: %s %s", req.URL, res.Status, strings.TrimSpace(string(bs)))
+	return nil, res.StatusCode == http.StatusTooManyRequests || res.StatusCode/100 == 5, err
+}
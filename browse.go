@@ -0,0 +1,303 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LogFile 日志目录下的文件信息
+type LogFile struct {
+	Path    string    `json:"path"`              // 相对日志目录的路径，使用/分隔
+	Size    int64     `json:"size"`              // 文件大小
+	ModTime time.Time `json:"modTime"`           // 修改时间
+	Entries []string  `json:"entries,omitempty"` // zip压缩包内的文件列表
+}
+
+// ListLogFiles 列出日志目录下所有的日志文件和压缩包
+func ListLogFiles(root string) ([]LogFile, error) {
+	var files []LogFile
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// 跳过.logger.lock等隐藏文件和current.log等符号链接
+		if p != root && hiddenFile(info.Name()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() || info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		f := LogFile{Path: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime()}
+		if isArchive(info.Name()) {
+			f.Entries, _ = zipEntries(root, f.Path)
+		}
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+// hiddenFile .logger.lock、.logger.audit等隐藏文件和SHA256SUMS清单不在日志浏览中显示和下载
+func hiddenFile(name string) bool {
+	return strings.HasPrefix(name, ".") || name == ManifestName
+}
+
+// safePath 把相对路径限制在root目录内，路径中不能有隐藏文件或目录
+func safePath(root, file string) (string, error) {
+	if file == "" {
+		return "", errors.New("file required")
+	}
+	for _, name := range strings.Split(path.Clean("/"+file), "/") {
+		if hiddenFile(name) {
+			return "", os.ErrNotExist
+		}
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	p := filepath.Join(absRoot, filepath.FromSlash(path.Clean("/"+file)))
+
+	// 符号链接也不能指向日志目录之外
+	realRoot, err := filepath.EvalSymlinks(absRoot)
+	if err != nil {
+		return "", err
+	}
+	realPath, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", err
+	}
+	if realPath != realRoot && !strings.HasPrefix(realPath, realRoot+string(filepath.Separator)) {
+		return "", errors.New("file outside log path")
+	}
+	return p, nil
+}
+
+// zipEntries 返回zip压缩包内的文件列表
+func zipEntries(root, file string) ([]string, error) {
+	p, err := safePath(root, file)
+	if err != nil {
+		return nil, err
+	}
+	zr, c, err := openArchive(p)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	var entries []string
+	for _, e := range zr.File {
+		entries = append(entries, e.Name)
+	}
+	return entries, nil
+}
+
+type zipEntryReader struct {
+	io.ReadCloser
+	zr io.Closer
+}
+
+func (o *zipEntryReader) Close() error {
+	o.ReadCloser.Close()
+	return o.zr.Close()
+}
+
+// OpenLogFile 打开日志目录下的文件，对于zip压缩包读取其中的entry文件
+// entry为空并且压缩包内只有一个文件时，直接读取这个文件，加密的压缩包使用SetArchiveKeys的密钥解密
+func OpenLogFile(root, file, entry string) (io.ReadCloser, error) {
+	p, err := safePath(root, file)
+	if err != nil {
+		return nil, err
+	}
+	if !isArchive(p) {
+		if entry != "" {
+			return nil, errors.New("entry only supported in zip files")
+		}
+		return os.Open(p)
+	}
+
+	zr, c, err := openArchive(p)
+	if err != nil {
+		return nil, err
+	}
+	if entry == "" && len(zr.File) == 1 {
+		entry = zr.File[0].Name
+	}
+	for _, f := range zr.File {
+		if f.Name != entry {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		return &zipEntryReader{ReadCloser: rc, zr: c}, nil
+	}
+	c.Close()
+	return nil, os.ErrNotExist
+}
+
+// readPage 按行分页读取，返回当前页的内容和总行数
+func readPage(r io.Reader, page, size int) ([]string, int, error) {
+	var lines []string
+	total := 0
+	start := page * size
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for s.Scan() {
+		if total >= start && total < start+size {
+			lines = append(lines, s.Text())
+		}
+		total++
+	}
+	return lines, total, s.Err()
+}
+
+// handleLogs 注册日志浏览、查看、下载接口
+func handleLogs(ms *http.ServeMux, root string) {
+	ms.HandleFunc("/logs", func(w http.ResponseWriter, r *http.Request) {
+		files, err := ListLogFiles(root)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		logsTpl.Execute(w, files)
+	})
+
+	ms.HandleFunc("/logs/tree", func(w http.ResponseWriter, r *http.Request) {
+		files, err := ListLogFiles(root)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(files)
+	})
+
+	ms.HandleFunc("/logs/view", func(w http.ResponseWriter, r *http.Request) {
+		file, entry := r.FormValue("file"), r.FormValue("entry")
+		page, _ := strconv.Atoi(r.FormValue("page"))
+		size, _ := strconv.Atoi(r.FormValue("size"))
+		if page < 0 {
+			page = 0
+		}
+		if size <= 0 || size > 10000 {
+			size = 500
+		}
+
+		rc, err := OpenLogFile(root, file, entry)
+		if err != nil {
+			httpFileError(w, err)
+			return
+		}
+		defer rc.Close()
+		lines, total, err := readPage(rc, page, size)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		v := struct {
+			File  string   `json:"file"`
+			Entry string   `json:"entry,omitempty"`
+			Page  int      `json:"page"`
+			Size  int      `json:"size"`
+			Total int      `json:"total"`
+			Lines []string `json:"lines"`
+			Prev  int      `json:"-"`
+			Next  int      `json:"-"`
+		}{File: file, Entry: entry, Page: page, Size: size, Total: total, Lines: lines, Prev: -1, Next: -1}
+		if page > 0 {
+			v.Prev = page - 1
+		}
+		if (page+1)*size < total {
+			v.Next = page + 1
+		}
+
+		if r.FormValue("format") == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(&v)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		viewTpl.Execute(w, &v)
+	})
+
+	ms.HandleFunc("/logs/download", func(w http.ResponseWriter, r *http.Request) {
+		p, err := safePath(root, r.FormValue("file"))
+		if err != nil {
+			httpFileError(w, err)
+			return
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			httpFileError(w, err)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="`+info.Name()+`"`)
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	})
+}
+
+func httpFileError(w http.ResponseWriter, err error) {
+	if os.IsNotExist(err) {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+var logsTpl = template.Must(template.New("logs").Parse(`
+<a href="/">LOG_LEVEL</a>
+<table>
+	{{range .}}
+	<tr>
+		<td>{{.Path}}</td>
+		<td>{{.Size}}</td>
+		<td>{{.ModTime.Format "2006-01-02 15:04:05"}}</td>
+		<td>
+			{{$path := .Path}}
+			{{if .Entries}}{{range .Entries}}<a href="/logs/view?file={{$path}}&entry={{.}}">{{.}}</a> {{end}}{{else}}<a href="/logs/view?file={{.Path}}">view</a>{{end}}
+			<a href="/logs/download?file={{.Path}}">download</a>
+		</td>
+	</tr>
+	{{end}}
+</table>
+`))
+
+var viewTpl = template.Must(template.New("view").Parse(`
+<a href="/logs">Logs</a> {{.File}} {{.Entry}} ({{.Total}})
+{{if ge .Prev 0}}<a href="/logs/view?file={{.File}}&entry={{.Entry}}&size={{.Size}}&page={{.Prev}}">Prev</a>{{end}}
+{{if ge .Next 0}}<a href="/logs/view?file={{.File}}&entry={{.Entry}}&size={{.Size}}&page={{.Next}}">Next</a>{{end}}
+<pre>{{range .Lines}}{{.}}
+{{end}}</pre>
+`))
@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// go test -run TestBrowse -v -count=1
+func TestBrowse(t *testing.T) {
+	root, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(root)
+	os.MkdirAll(filepath.Join(root, "lable/2019/02"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "lable/2019/02/name_2019-02-02.log"), []byte("a\nb\nc\n"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "secret.txt"), []byte("secret"), 0644)
+	fz, _ := os.Create(filepath.Join(root, "lable/2019/02/name_2019-02-01.zip"))
+	zw := zip.NewWriter(fz)
+	fw, _ := zw.Create("name_2019-02-01.log")
+	fw.Write([]byte("z1\nz2\n"))
+	zw.Close()
+	fz.Close()
+
+	ms := http.NewServeMux()
+	handleLogs(ms, filepath.Join(root, "lable"))
+	ts := httptest.NewServer(ms)
+	defer ts.Close()
+
+	get := func(url string) (int, string) {
+		res, err := http.Get(ts.URL + url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		bs, _ := ioutil.ReadAll(res.Body)
+		return res.StatusCode, string(bs)
+	}
+
+	_, body := get("/logs/tree")
+	var files []LogFile
+	if err := json.Unmarshal([]byte(body), &files); err != nil || len(files) != 2 {
+		t.Fatal(body, err)
+	}
+	if files[0].Path != "2019/02/name_2019-02-01.zip" || len(files[0].Entries) != 1 {
+		t.Fatal(files)
+	}
+
+	_, body = get("/logs/view?format=json&file=2019/02/name_2019-02-02.log&size=2&page=1")
+	var v struct {
+		Total int
+		Lines []string
+	}
+	json.Unmarshal([]byte(body), &v)
+	if v.Total != 3 || len(v.Lines) != 1 || v.Lines[0] != "c" {
+		t.Fatal(body)
+	}
+
+	_, body = get("/logs/view?format=json&file=2019/02/name_2019-02-01.zip")
+	if !strings.Contains(body, "z2") {
+		t.Fatal(body)
+	}
+
+	if code, body := get("/logs/download?file=2019/02/name_2019-02-02.log"); code != 200 || body != "a\nb\nc\n" {
+		t.Fatal(code, body)
+	}
+	if code, _ := get("/logs/download?file=../secret.txt"); code == 200 {
+		t.Fatal("escaped log path")
+	}
+	// 不能下载锁、审计链头和清单等隐藏文件
+	os.MkdirAll(filepath.Join(root, "lable/.tmp"), 0755)
+	for _, f := range []string{".logger.lock", ".logger.audit", "2019/02/" + ManifestName, ".tmp/name_2019-02-03.log"} {
+		ioutil.WriteFile(filepath.Join(root, "lable", f), []byte("state"), 0644)
+		if code, _ := get("/logs/download?file=" + f); code != 404 {
+			t.Fatal(f, code)
+		}
+	}
+	if files, _ := ListLogFiles(filepath.Join(root, "lable")); len(files) != 2 {
+		t.Fatal(files)
+	}
+	if code, _ := get("/logs/view?file=2019/02/none.log"); code != 404 {
+		t.Fatal(code)
+	}
+}
@@ -0,0 +1,21 @@
+// Package clock 时间来源的抽象，DefaultWriter、Monitor和Logger通过Clock获取时间和定时，
+// 测试时使用clocktest.Clock控制时间，不需要等待真实的时间流逝。
+package clock
+
+import "time"
+
+// Clock 时间来源
+type Clock interface {
+	Now() time.Time                         // 当前时间
+	After(d time.Duration) <-chan time.Time // d后返回当时的时间
+	Sleep(d time.Duration)                  // 等待d
+}
+
+// Real 使用系统时间
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) Sleep(d time.Duration)                  { time.Sleep(d) }
@@ -0,0 +1,98 @@
+// Package clocktest 测试用的Clock，时间只在调用Add或Set时前进
+//
+//	c := clocktest.New(time.Date(2019, 1, 31, 23, 59, 0, 0, time.Local))
+//	w := logger.NewDefaultWriter(&logger.DefaultWriterOption{Clock: c})
+//	c.BlockUntil(1)     // 等待DefaultWriter开始等待明天
+//	c.Add(time.Minute) // 进入2月，切换日志文件并压缩1月的日志
+package clocktest
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock 手动控制的时间
+type Clock struct {
+	lock    sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	waiters []*waiter
+}
+
+type waiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+// New 返回时间为t的Clock
+func New(t time.Time) *Clock {
+	c := &Clock{now: t}
+	c.cond = sync.NewCond(&c.lock)
+	return c
+}
+
+// Now ...
+func (c *Clock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// After 时间前进到d后返回，d<=0时立即返回
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- c.now
+		return ch
+	}
+	c.waiters = append(c.waiters, &waiter{at: c.now.Add(d), ch: ch})
+	c.cond.Broadcast()
+	return ch
+}
+
+// Sleep 等待时间前进到d后
+func (c *Clock) Sleep(d time.Duration) {
+	<-c.After(d)
+}
+
+// Add 时间前进d，按时间顺序唤醒到期的After和Sleep
+func (c *Clock) Add(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set 设置当前时间，唤醒到期的After和Sleep
+func (c *Clock) Set(t time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.now = t
+	sort.SliceStable(c.waiters, func(i, j int) bool { return c.waiters[i].at.Before(c.waiters[j].at) })
+	n := 0
+	for _, w := range c.waiters {
+		if w.at.After(t) {
+			c.waiters[n] = w
+			n++
+			continue
+		}
+		w.ch <- t
+	}
+	c.waiters = c.waiters[:n]
+}
+
+// Waiters 正在等待的After和Sleep的数量
+func (c *Clock) Waiters() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.waiters)
+}
+
+// BlockUntil 等待直到至少有n个After或Sleep在等待，用于确认后台goroutine已经开始等待
+func (c *Clock) BlockUntil(n int) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	for len(c.waiters) < n {
+		c.cond.Wait()
+	}
+}
@@ -0,0 +1,53 @@
+package clocktest
+
+import (
+	"testing"
+	"time"
+)
+
+// go test github.com/ohko/logger/clock/clocktest -v -count=1
+func TestClock(t *testing.T) {
+	start := time.Date(2019, 1, 31, 23, 59, 0, 0, time.UTC)
+	c := New(start)
+	if !c.Now().Equal(start) {
+		t.Fatal(c.Now())
+	}
+
+	// d<=0立即返回
+	select {
+	case <-c.After(0):
+	default:
+		t.Fatal("After(0) blocked")
+	}
+
+	done := make(chan time.Time)
+	go func() {
+		c.Sleep(time.Minute)
+		done <- c.Now()
+	}()
+	c.BlockUntil(1)
+	a := c.After(time.Hour)
+
+	c.Add(30 * time.Second)
+	select {
+	case <-done:
+		t.Fatal("woke too early")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	c.Add(30 * time.Second)
+	if now := <-done; !now.Equal(start.Add(time.Minute)) {
+		t.Fatal(now)
+	}
+	if c.Waiters() != 1 {
+		t.Fatal(c.Waiters())
+	}
+
+	c.Set(start.Add(2 * time.Hour))
+	if at := <-a; !at.Equal(start.Add(2 * time.Hour)) {
+		t.Fatal(at)
+	}
+	if c.Waiters() != 0 {
+		t.Fatal(c.Waiters())
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ohko/logger"
+)
+
+// audit 校验审计日志的哈希链，断开时输出第一个断开的位置，退出码为1
+func audit(args []string) {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	path := fs.String("path", "./log", "日志目录")
+	label := fs.String("label", "", "日志标签")
+	hmacKey := fs.String("hmac", os.Getenv("LOGGER_AUDIT_KEY"), "HMAC密钥的hex，默认使用环境变量LOGGER_AUDIT_KEY")
+	start := fs.String("start", "", "删除过期日志后保留的最早的日志文件的prev，默认只接受从全0开始的审计链")
+	keys := addKeysFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s audit [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := setArchiveKeys(*keys); err != nil {
+		fatal(err)
+	}
+	option := &logger.AuditVerifyOption{}
+	var err error
+	if option.Key, err = hex.DecodeString(*hmacKey); err != nil {
+		fatal(err)
+	}
+	if *start != "" {
+		if option.Start, err = hex.DecodeString(*start); err != nil {
+			fatal(err)
+		}
+	}
+
+	n, brk, err := logger.VerifyAudit((&queryFlags{path: path, label: label}).root(), option)
+	if err != nil {
+		fatal(err)
+	}
+	if brk != nil {
+		fmt.Println(brk)
+		fmt.Fprintf(os.Stderr, "%d entries verified before the break\n", n)
+		os.Exit(1)
+	}
+	fmt.Printf("OK %d entries\n", n)
+}
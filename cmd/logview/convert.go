@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ohko/logger"
+)
+
+// convert 把日志目录转换为JSON lines
+// 没有-out参数时输出到stdout，否则在-out目录下为每个日志文件生成对应的.jsonl文件
+func convert(args []string) {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	fq := addQueryFlags(fs)
+	out := fs.String("out", "", "输出目录，为空时输出到stdout")
+	gz := fs.Bool("gzip", false, "输出gzip压缩的.jsonl.gz文件，需要-out参数")
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s convert [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	q, err := fq.query()
+	if err != nil {
+		fatal(err)
+	}
+	if *out != "" {
+		if err := logger.ConvertFiles(fq.root(), *out, *gz, q); err != nil {
+			fatal(err)
+		}
+		return
+	}
+	if *gz {
+		fatal(fmt.Errorf("-gzip requires -out"))
+	}
+
+	defer stdout.Flush()
+	if err := logger.ConvertJSONL(fq.root(), stdout, q); err != nil {
+		fatal(err)
+	}
+}
@@ -0,0 +1,345 @@
+// logview 查看DefaultWriter输出的日志目录，支持zip压缩包、过滤、跟踪和JSON输出
+//
+//	logview -path ./log -label lable -level 1,2 -f
+//	logview -json ./log/lable/2019/2019-01.zip
+//	logview convert -path ./log -label lable -out ./jsonl -gzip
+//	logview verify -path ./log
+//	logview audit -path ./log -label lable -hmac 0011...
+//	LOGGER_ARCHIVE_KEYS=k1:0011... logview -path ./log -label lable
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ohko/logger"
+	"github.com/ohko/logger/parser"
+)
+
+var (
+	flagFollow = flag.Bool("f", false, "跟踪当天的日志文件，跨天自动切换")
+	flagLink   = flag.String("link", "current.log", "DefaultWriterOption.CurrentLink，跟踪模式跟随它指向的日志文件")
+	flagName   = flag.String("name", "", "FixedName模式的日志文件名，跟踪模式在没有-link时跟踪 -path/-label/<name>.log")
+	flagLines  = flag.Int("n", 10, "跟踪模式下先显示的最近日志条数")
+	flagColor  = flag.Bool("color", false, "按日志等级显示颜色")
+	flagJSON   = flag.Bool("json", false, "以JSON lines格式输出")
+	flagQuery  = addQueryFlags(flag.CommandLine)
+
+	// stdout 带缓存的标准输出，fatal退出前输出缓存的内容
+	stdout = bufio.NewWriter(os.Stdout)
+)
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "convert" {
+		convert(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		verify(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		audit(os.Args[2:])
+		return
+	}
+
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [flags] [file...]\n       %s convert [flags]\n       %s verify [flags]\n       %s audit [flags]\n", os.Args[0], os.Args[0], os.Args[0], os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	q, err := flagQuery.query()
+	if err != nil {
+		fatal(err)
+	}
+	defer stdout.Flush()
+	show := func(l *logger.QueryLine) error {
+		return printLine(stdout, l)
+	}
+
+	switch {
+	case flag.NArg() > 0:
+		for _, file := range flag.Args() {
+			if err := logger.QueryFile(filepath.Dir(file), filepath.Base(file), q, show); err != nil {
+				fatal(err)
+			}
+		}
+	case *flagFollow:
+		if err := follow(stdout, q); err != nil {
+			fatal(err)
+		}
+	default:
+		if err := logger.Query(flagQuery.root(), q, show); err != nil {
+			fatal(err)
+		}
+	}
+}
+
+// fatal os.Exit不执行defer，先输出stdout中缓存的内容
+func fatal(err error) {
+	stdout.Flush()
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// queryFlags 日志目录和过滤条件参数
+type queryFlags struct {
+	path, label                         *string
+	level, prefix, start, end, text, re *string
+	keys, tz                            *string
+}
+
+func addQueryFlags(fs *flag.FlagSet) *queryFlags {
+	return &queryFlags{
+		path:   fs.String("path", "./log", "日志目录"),
+		label:  fs.String("label", "", "日志标签"),
+		level:  fs.String("level", "", "日志等级，逗号分隔，例如 1,2,3"),
+		prefix: fs.String("prefix", "", "日志前缀"),
+		start:  fs.String("start", "", "开始时间 2006-01-02 15:04:05"),
+		end:    fs.String("end", "", "结束时间 2006-01-02 15:04:05"),
+		text:   fs.String("text", "", "包含的文本"),
+		re:     fs.String("regexp", "", "匹配的正则表达式"),
+		keys:   addKeysFlag(fs),
+		tz:     fs.String("tz", "", "日志文件名中日期和-start/-end的时区，与DefaultWriterOption.Location相同，例如Asia/Shanghai，默认本地时区"),
+	}
+}
+
+func (o *queryFlags) root() string {
+	return filepath.Join(*o.path, *o.label)
+}
+
+func (o *queryFlags) query() (*logger.QueryOption, error) {
+	if err := setArchiveKeys(*o.keys); err != nil {
+		return nil, err
+	}
+	// 无法读取的文件跳过后输出到stderr
+	q := &logger.QueryOption{Prefix: *o.prefix, Text: *o.text, Location: time.Local, OnError: func(err error) {
+		stdout.Flush()
+		fmt.Fprintln(os.Stderr, err)
+	}}
+	var err error
+	if *o.tz != "" {
+		if q.Location, err = time.LoadLocation(*o.tz); err != nil {
+			return nil, err
+		}
+	}
+	if *o.start != "" {
+		if q.Start, err = parseTime(*o.start, q.Location); err != nil {
+			return nil, err
+		}
+	}
+	if *o.end != "" {
+		if q.End, err = parseTime(*o.end, q.Location); err != nil {
+			return nil, err
+		}
+	}
+	if *o.level != "" {
+		for _, v := range strings.Split(*o.level, ",") {
+			level, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return nil, err
+			}
+			q.Levels = append(q.Levels, level)
+		}
+	}
+	if *o.re != "" {
+		if q.Regexp, err = regexp.Compile(*o.re); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+// addKeysFlag 解密.zip.enc压缩文件的密钥，默认读取环境变量，避免密钥出现在命令行中
+func addKeysFlag(fs *flag.FlagSet) *string {
+	return fs.String("key", os.Getenv("LOGGER_ARCHIVE_KEYS"), "解密压缩文件的密钥，格式为 id:hex，多个用逗号分隔，默认使用环境变量LOGGER_ARCHIVE_KEYS")
+}
+
+func setArchiveKeys(s string) error {
+	if s == "" {
+		return nil
+	}
+	kp, err := logger.ParseStaticKeys(s)
+	if err != nil {
+		return err
+	}
+	logger.SetArchiveKeys(kp)
+	return nil
+}
+
+func parseTime(s string, loc *time.Location) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+var (
+	tagRe  = regexp.MustCompile(`\[([^\[\]]*):([DWEFTN])\]`)
+	colors = map[string]string{
+		"D": "\033[32m",
+		"W": "\033[33m",
+		"E": "\033[31m",
+		"F": "\033[31;1;7m",
+		"T": "\033[37m",
+	}
+)
+
+// colorize 与Logger.SetColor(true)相同的方式显示日志标签
+func colorize(text string) string {
+	text = parser.StripColor(text)
+	loc := tagRe.FindStringSubmatchIndex(text)
+	if loc == nil {
+		return text
+	}
+	color, ok := colors[text[loc[4]:loc[5]]]
+	if !ok {
+		return text
+	}
+	return text[:loc[0]] + color + text[loc[0]:loc[1]] + " \033[m" + text[loc[1]:]
+}
+
+func printLine(w io.Writer, l *logger.QueryLine) error {
+	if *flagJSON {
+		return json.NewEncoder(w).Encode(l)
+	}
+	text := l.Text
+	if *flagColor {
+		text = colorize(text)
+	}
+	_, err := io.WriteString(w, text+"\n")
+	return err
+}
+
+// currentFile DefaultWriter正在写入的日志文件，跟随CurrentLink，支持自定义的Template
+// 没有CurrentLink时(FixedName或NoCurrentLink)为 -path/-label/<name>.log
+func currentFile() string {
+	if *flagLink != "" {
+		if f, err := filepath.EvalSymlinks(filepath.Join(flagQuery.root(), *flagLink)); err == nil {
+			return f
+		}
+	}
+	return filepath.Join(flagQuery.root(), *flagName+".log")
+}
+
+// follow 跟踪正在写入的日志文件，CurrentLink指向新的文件后读完旧文件再切换到新文件
+// 文件被logrotate移动或截断后从头读取新的内容
+func follow(out *bufio.Writer, q *logger.QueryOption) error {
+	file := currentFile()
+
+	// 先显示最近的n条日志
+	var last []*logger.QueryLine
+	_, err := os.Stat(file)
+	seekEnd := err == nil
+	logger.QueryFile(filepath.Dir(file), filepath.Base(file), q, func(l *logger.QueryLine) error {
+		last = append(last, l)
+		if len(last) > *flagLines {
+			last = last[1:]
+		}
+		return nil
+	})
+	for _, l := range last {
+		printLine(out, l)
+	}
+	out.Flush()
+
+	var f *os.File
+	var r *bufio.Reader
+	var entry []string
+	partial := ""
+	flush := func() {
+		if len(entry) == 0 {
+			return
+		}
+		text := strings.Join(entry, "\n")
+		e, err := parser.ParseLine(text)
+		if err != nil {
+			e = &parser.Entry{Level: parser.LevelNormal, Message: parser.StripColor(text), Raw: text}
+		}
+		l := logger.NewQueryLine(filepath.Base(file), "", e)
+		if q.Match(l) {
+			printLine(out, l)
+		}
+		entry = entry[:0]
+	}
+
+	for {
+		if f == nil {
+			var err error
+			if f, err = os.Open(file); err == nil {
+				if seekEnd {
+					f.Seek(0, io.SeekEnd)
+				}
+				r = bufio.NewReader(f)
+			}
+		}
+
+		read := false
+		for f != nil {
+			s, err := r.ReadString('\n')
+			if err != nil {
+				partial += s
+				break
+			}
+			read = true
+			line := strings.TrimSuffix(partial+s, "\n")
+			partial = ""
+			if parser.IsAuditMarker(line) {
+				continue
+			}
+			if parser.IsEntryStart(line) {
+				flush()
+			}
+			entry = append(entry, line)
+		}
+		if read {
+			continue
+		}
+
+		// 没有新的内容，输出缓存的日志
+		flush()
+		out.Flush()
+
+		// 日志已切换到新的文件
+		if next := currentFile(); next != file {
+			if _, err := os.Stat(next); err == nil {
+				if f != nil {
+					f.Close()
+				}
+				file, f, r, partial = next, nil, nil, ""
+				seekEnd = false
+				continue
+			}
+		}
+		if f != nil {
+			fi, err := os.Stat(file)
+			cur, _ := f.Stat()
+			if err == nil && cur != nil && !os.SameFile(fi, cur) {
+				// 文件被移动后重新打开同名的新文件
+				f.Close()
+				f, r, partial = nil, nil, ""
+				seekEnd = false
+				continue
+			}
+			if off, err := f.Seek(0, io.SeekCurrent); err == nil && fi != nil && fi.Size() < off {
+				// copytruncate截断后从头读取
+				f.Seek(0, io.SeekStart)
+				r.Reset(f)
+				partial = ""
+			}
+		}
+		time.Sleep(time.Millisecond * 200)
+	}
+}
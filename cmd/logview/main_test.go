@@ -0,0 +1,42 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestColorize(t *testing.T) {
+	if s := colorize("2019/02/02 10:00:00 /a.go:1: [api:E]boom"); s != "2019/02/02 10:00:00 /a.go:1: \033[31m[api:E] \033[mboom" {
+		t.Fatalf("%q", s)
+	}
+	if s := colorize("\033[32m[api:D] \033[mdebug"); s != "\033[32m[api:D] \033[mdebug" {
+		t.Fatalf("%q", s)
+	}
+	if s := colorize("[api:N]normal"); s != "[api:N]normal" {
+		t.Fatalf("%q", s)
+	}
+}
+
+func TestCurrentFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logview")
+	defer os.RemoveAll(dir)
+	*flagQuery.path, *flagQuery.label, *flagName = dir, "app", "api"
+
+	// 跟随CurrentLink，与Template无关
+	file := filepath.Join(dir, "app", "web1", "2019-02-01", "api.0.log")
+	os.MkdirAll(filepath.Dir(file), 0755)
+	ioutil.WriteFile(file, nil, 0644)
+	os.Symlink("web1/2019-02-01/api.0.log", filepath.Join(dir, "app", "current.log"))
+	want, _ := filepath.EvalSymlinks(file)
+	if f := currentFile(); f != want {
+		t.Fatal(f, want)
+	}
+
+	// 没有CurrentLink时为FixedName的日志文件
+	os.Remove(filepath.Join(dir, "app", "current.log"))
+	if f := currentFile(); f != filepath.Join(dir, "app", "api.log") {
+		t.Fatal(f)
+	}
+}
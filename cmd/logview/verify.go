@@ -0,0 +1,49 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/ohko/logger"
+)
+
+// verify 校验日志目录中所有压缩文件的SHA-256和CRC，有错误时退出码为1
+func verify(args []string) {
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	path := fs.String("path", "./log", "日志目录")
+	label := fs.String("label", "", "日志标签，为空时校验整个日志目录")
+	quiet := fs.Bool("q", false, "只输出校验失败的压缩文件")
+	keys := addKeysFlag(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s verify [flags]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if err := setArchiveKeys(*keys); err != nil {
+		fatal(err)
+	}
+
+	result, err := logger.VerifyArchives((&queryFlags{path: path, label: label}).root())
+	if err != nil {
+		fatal(err)
+	}
+	failed, unlisted := 0, 0
+	for _, r := range result {
+		switch {
+		case r.Err != nil:
+			failed++
+			fmt.Printf("%s: FAILED %v\n", r.Path, r.Err)
+		case r.Unlisted:
+			// 增加SHA256SUMS之前的压缩文件只检查了CRC，不算失败
+			unlisted++
+			fmt.Printf("%s: OK (not in %s)\n", r.Path, logger.ManifestName)
+		case !*quiet:
+			fmt.Printf("%s: OK\n", r.Path)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "%d archives, %d failed, %d not in manifest\n", len(result), failed, unlisted)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
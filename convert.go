@@ -0,0 +1,121 @@
+package logger
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ohko/logger/parser"
+)
+
+// ConvertRecord 转换后的JSON日志
+type ConvertRecord struct {
+	Time    *time.Time `json:"time,omitempty"`   // 日志时间，RFC3339格式
+	Level   string     `json:"level"`            // 日志等级名称 debug/warning/error/fatal/trace/normal
+	Prefix  string     `json:"prefix"`           // 日志前缀
+	Caller  string     `json:"caller,omitempty"` // 调用者文件
+	Line    int        `json:"line,omitempty"`   // 调用者行号
+	Message string     `json:"message"`          // 日志内容
+	File    string     `json:"file,omitempty"`   // 来源日志文件，相对日志目录
+	Entry   string     `json:"entry,omitempty"`  // 来源zip压缩包内的文件
+	Date    string     `json:"date,omitempty"`   // 来源日志文件名中的日期
+}
+
+// NewConvertRecord ...
+func NewConvertRecord(l *QueryLine) *ConvertRecord {
+	r := &ConvertRecord{
+		Level:   parser.LevelName(l.Level),
+		Prefix:  l.Prefix,
+		Caller:  l.Caller,
+		Line:    l.Line,
+		Message: l.Message,
+		File:    l.File,
+		Entry:   l.Entry,
+	}
+	if !l.Time.IsZero() {
+		t := l.Time
+		r.Time = &t
+	}
+	source := l.File
+	if l.Entry != "" {
+		source = l.Entry
+	}
+	r.Date = fileDay(source)
+	return r
+}
+
+// ConvertJSONL 把日志目录下的日志文件和压缩包转换为JSON lines写入w
+func ConvertJSONL(root string, w io.Writer, q *QueryOption) error {
+	enc := json.NewEncoder(w)
+	return Query(root, q, func(l *QueryLine) error {
+		return enc.Encode(NewConvertRecord(l))
+	})
+}
+
+// ConvertFiles 把日志目录下的每个日志文件(zip压缩包内的每个文件)转换为out目录下对应的JSON lines文件
+// gz为true时输出.jsonl.gz文件，否则输出.jsonl文件
+func ConvertFiles(root, out string, gz bool, q *QueryOption) error {
+	var (
+		source string
+		f      *os.File
+		zw     *gzip.Writer
+		enc    *json.Encoder
+	)
+	closeFile := func() error {
+		if f == nil {
+			return nil
+		}
+		var err error
+		if zw != nil {
+			err = zw.Close()
+		}
+		if e := f.Close(); err == nil {
+			err = e
+		}
+		f, zw = nil, nil
+		return err
+	}
+
+	err := Query(root, q, func(l *QueryLine) error {
+		if s := l.File + "\x00" + l.Entry; s != source || f == nil {
+			if err := closeFile(); err != nil {
+				return err
+			}
+			source = s
+
+			// 2019/2019-01.zip 内的 name_2019-01-02.log 输出为 2019/name_2019-01-02.jsonl
+			name := path.Base(l.File)
+			if l.Entry != "" {
+				name = path.Base(l.Entry)
+			}
+			name = strings.TrimSuffix(name, path.Ext(name)) + ".jsonl"
+			if gz {
+				name += ".gz"
+			}
+			file := filepath.Join(out, filepath.FromSlash(path.Dir(l.File)), name)
+			if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+				return err
+			}
+			var err error
+			if f, err = os.Create(file); err != nil {
+				return err
+			}
+			if gz {
+				zw = gzip.NewWriter(f)
+				enc = json.NewEncoder(zw)
+			} else {
+				enc = json.NewEncoder(f)
+			}
+		}
+		return enc.Encode(NewConvertRecord(l))
+	})
+	if e := closeFile(); err == nil {
+		err = e
+	}
+	return err
+}
@@ -0,0 +1,64 @@
+package logger
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// go test -run TestConvert -v -count=1
+func TestConvert(t *testing.T) {
+	root, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(root)
+	os.MkdirAll(filepath.Join(root, "log/2019/02"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "log/2019/02/name_2019-02-02.log"), []byte(
+		"10:00:00 /src/a.go:10: [api:W]warn\nline2\n"), 0644)
+	fz, _ := os.Create(filepath.Join(root, "log/2019/2019-01.zip"))
+	zw := zip.NewWriter(fz)
+	fw, _ := zw.Create("name_2019-01-31.log")
+	fw.Write([]byte("2019/01/31 23:00:00 /src/a.go:10: [api:E]error in zip\n"))
+	zw.Close()
+	fz.Close()
+
+	buf := bytes.NewBuffer(nil)
+	if err := ConvertJSONL(filepath.Join(root, "log"), buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatal(buf.String())
+	}
+	var r ConvertRecord
+	json.Unmarshal([]byte(lines[1]), &r)
+	if r.Level != "warning" || r.Message != "warn\nline2" || r.Date != "2019-02-02" || r.Time == nil || r.Time.Hour() != 10 || r.Time.Day() != 2 {
+		t.Fatal(lines[1])
+	}
+
+	out := filepath.Join(root, "out")
+	if err := ConvertFiles(filepath.Join(root, "log"), out, true, nil); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(filepath.Join(out, "2019/name_2019-01-31.jsonl.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := ioutil.ReadAll(zr)
+	json.Unmarshal(bs, &r)
+	if r.File != "2019/2019-01.zip" || r.Entry != "name_2019-01-31.log" || r.Date != "2019-01-31" || r.Level != "error" {
+		t.Fatal(string(bs))
+	}
+	if _, err := os.Stat(filepath.Join(out, "2019/02/name_2019-02-02.jsonl.gz")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,268 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ohko/logger/parser"
+)
+
+// ElasticWriterOption ...
+type ElasticWriterOption struct {
+	URL        string        // Elasticsearch/OpenSearch地址，例如 http://127.0.0.1:9200
+	Index      string        // 索引前缀，实际索引为 Index-2006.01.02，默认logger
+	IndexDate  string        // 索引日期格式，默认2006.01.02，与DefaultWriter按日切割一致
+	Username   string        // Basic认证用户名
+	Password   string        // Basic认证密码
+	Label      string        // 日志标签，与DefaultWriterOption.Label相同
+	BatchSize  int           // 每批最多的日志条数，默认500
+	BatchWait  time.Duration // 每批最长的等待时间，默认1秒
+	BufferSize int           // 等待发送的最多日志条数，超出后丢弃，默认10000
+	MaxRetries int           // 失败重试次数，默认3次
+	MinBackoff time.Duration // 第一次重试的等待时间，默认500毫秒
+	MaxBackoff time.Duration // 最长的重试等待时间，默认10秒
+	Timeout    time.Duration // HTTP请求超时，默认10秒
+	DeadLetter string        // 重试后仍然失败的日志写入的文件，JSON lines格式，为空时丢弃
+	OnError    func(error)   // 发送失败、日志被拒绝和写DeadLetter失败的回调
+}
+
+// ElasticWriter 通过_bulk接口批量写入Elasticsearch/OpenSearch
+// 部分失败时只重试失败的日志，仍然失败的写入DeadLetter文件
+type ElasticWriter struct {
+	option *ElasticWriterOption
+	client *http.Client
+	batch  *batcher
+	lock   sync.Mutex
+}
+
+// ElasticDocument 写入Elasticsearch的日志
+type ElasticDocument struct {
+	Timestamp time.Time  `json:"@timestamp"`
+	LogTime   *time.Time `json:"log_time,omitempty"` // 日志内容中的时间
+	Level     string     `json:"level"`
+	Prefix    string     `json:"prefix,omitempty"`
+	Label     string     `json:"label,omitempty"`
+	Caller    string     `json:"caller,omitempty"`
+	Line      int        `json:"line,omitempty"`
+	Message   string     `json:"message"`
+}
+
+// NewElasticWriter ...
+func NewElasticWriter(option *ElasticWriterOption) *ElasticWriter {
+	o := &ElasticWriter{option: option}
+	if o.option == nil {
+		o.option = &ElasticWriterOption{}
+	}
+	if o.option.URL == "" {
+		o.option.URL = "http://127.0.0.1:9200"
+	}
+	if o.option.Index == "" {
+		o.option.Index = "logger"
+	}
+	if o.option.IndexDate == "" {
+		o.option.IndexDate = "2006.01.02"
+	}
+	if o.option.BatchSize <= 0 {
+		o.option.BatchSize = 500
+	}
+	if o.option.BatchWait <= 0 {
+		o.option.BatchWait = time.Second
+	}
+	if o.option.BufferSize <= 0 {
+		o.option.BufferSize = 10000
+	}
+	if o.option.MaxRetries <= 0 {
+		o.option.MaxRetries = 3
+	}
+	if o.option.MinBackoff <= 0 {
+		o.option.MinBackoff = time.Millisecond * 500
+	}
+	if o.option.MaxBackoff <= 0 {
+		o.option.MaxBackoff = time.Second * 10
+	}
+	if o.option.Timeout <= 0 {
+		o.option.Timeout = time.Second * 10
+	}
+	o.client = &http.Client{Timeout: o.option.Timeout}
+	o.batch = newBatcher(o.option.BatchSize, o.option.BatchWait, o.option.BufferSize, o.push)
+	o.batch.onError = o.option.OnError
+	return o
+}
+
+// Write 每次Write是一条Logger日志
+func (o *ElasticWriter) Write(p []byte) (n int, err error) {
+	if err := o.batch.add(newSinkEntry(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close 发送剩余的日志
+func (o *ElasticWriter) Close() error {
+	o.batch.close()
+	return nil
+}
+
+func (o *ElasticWriter) document(e *sinkEntry) *ElasticDocument {
+	doc := &ElasticDocument{
+		Timestamp: e.Time,
+		Level:     parser.LevelName(e.Level),
+		Prefix:    e.Prefix,
+		Label:     strings.TrimPrefix(o.option.Label, "/"),
+		Caller:    e.Caller,
+		Line:      e.Line,
+		Message:   e.Message,
+	}
+	if !e.Entry.Time.IsZero() {
+		t := e.Entry.Time
+		doc.LogTime = &t
+	}
+	return doc
+}
+
+type elasticItem struct {
+	index string
+	doc   []byte
+}
+
+func (o *ElasticWriter) push(entries []*sinkEntry) error {
+	items := make([]*elasticItem, 0, len(entries))
+	for _, e := range entries {
+		doc, err := json.Marshal(o.document(e))
+		if err != nil {
+			continue
+		}
+		items = append(items, &elasticItem{index: o.option.Index + "-" + e.Time.Format(o.option.IndexDate), doc: doc})
+	}
+
+	var lastErr error
+	err := retry(retryOption{o.option.MaxRetries, o.option.MinBackoff, o.option.MaxBackoff}, func() (bool, error) {
+		failed, retryable, err := o.bulk(items)
+		if err != nil {
+			lastErr = err
+			return retryable, err
+		}
+		// 只重试失败的日志
+		items = failed
+		if len(items) > 0 {
+			lastErr = fmt.Errorf("elastic: %d items failed", len(items))
+			return true, lastErr
+		}
+		return false, nil
+	})
+	if err != nil && len(items) > 0 {
+		if e := o.deadLetter(items, lastErr); e != nil {
+			o.report(err)
+			return e
+		}
+	}
+	return err
+}
+
+// bulk 发送一次_bulk请求，返回失败并且可以重试的日志
+func (o *ElasticWriter) bulk(items []*elasticItem) ([]*elasticItem, bool, error) {
+	body := bytes.NewBuffer(nil)
+	for _, item := range items {
+		fmt.Fprintf(body, `{"index":{"_index":%q}}`+"\n", item.index)
+		body.Write(item.doc)
+		body.WriteByte('\n')
+	}
+
+	req, err := http.NewRequest("POST", strings.TrimSuffix(o.option.URL, "/")+"/_bulk", body)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	if o.option.Username != "" {
+		req.SetBasicAuth(o.option.Username, o.option.Password)
+	}
+	res, retryable, err := httpDo(o.client, req)
+	if err != nil {
+		return nil, retryable, err
+	}
+	defer res.Body.Close()
+
+	var v struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&v); err != nil {
+		return nil, true, err
+	}
+	if !v.Errors {
+		return nil, false, nil
+	}
+
+	var failed []*elasticItem
+	rejected := 0
+	var rejectErr, deadErr error
+	for i, result := range v.Items {
+		if i >= len(items) {
+			break
+		}
+		for _, r := range result {
+			// 429和5xx可以重试，其它错误(例如mapping错误)重试也不会成功，直接写入DeadLetter
+			if r.Status == http.StatusTooManyRequests || r.Status/100 == 5 {
+				failed = append(failed, items[i])
+			} else if r.Status/100 != 2 {
+				reason := fmt.Errorf("%d %s", r.Status, r.Error)
+				if rejected++; rejectErr == nil {
+					rejectErr = reason
+				}
+				if err := o.deadLetter([]*elasticItem{items[i]}, reason); err != nil && deadErr == nil {
+					deadErr = err
+				}
+			}
+		}
+	}
+	// 不能重试的日志和写DeadLetter失败都回调OnError
+	if rejected > 0 {
+		o.report(fmt.Errorf("elastic: %d items rejected: %v", rejected, rejectErr))
+	}
+	if deadErr != nil {
+		o.report(deadErr)
+	}
+	return failed, true, nil
+}
+
+func (o *ElasticWriter) report(err error) {
+	if o.option.OnError != nil {
+		o.option.OnError(err)
+	}
+}
+
+// deadLetter 把发送失败的日志追加到DeadLetter文件
+func (o *ElasticWriter) deadLetter(items []*elasticItem, reason error) error {
+	if o.option.DeadLetter == "" {
+		return nil
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	os.MkdirAll(filepath.Dir(o.option.DeadLetter), 0755)
+	f, err := os.OpenFile(o.option.DeadLetter, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, item := range items {
+		if err := enc.Encode(map[string]interface{}{
+			"index":    item.index,
+			"document": json.RawMessage(item.doc),
+			"error":    reason.Error(),
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
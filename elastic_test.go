@@ -0,0 +1,95 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// go test -run TestElastic -v -count=1
+func TestElastic(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+
+	var requests [][]string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_bulk" {
+			t.Error(r.URL.Path)
+		}
+		var lines []string
+		s := bufio.NewScanner(r.Body)
+		for s.Scan() {
+			lines = append(lines, s.Text())
+		}
+		requests = append(requests, lines)
+
+		// 第一次请求：第1条成功，第2条429，第3条mapping错误
+		if len(requests) == 1 {
+			fmt.Fprint(w, `{"errors":true,"items":[{"index":{"status":201}},{"index":{"status":429,"error":{"type":"es_rejected_execution_exception"}}},{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}}]}`)
+			return
+		}
+		fmt.Fprint(w, `{"errors":false,"items":[{"index":{"status":201}}]}`)
+	}))
+	defer ts.Close()
+
+	deadLetter := filepath.Join(dir, "dead.jsonl")
+	var errs []error
+	w := NewElasticWriter(&ElasticWriterOption{URL: ts.URL, Index: "app", Label: "lable", BatchSize: 3, BatchWait: time.Hour, MinBackoff: time.Millisecond, DeadLetter: deadLetter, OnError: func(err error) { errs = append(errs, err) }})
+	l := NewLogger(w)
+	l.SetPrefix("api")
+	l.Log0Debug("one")
+	l.Log1Warn("two")
+	l.Log2Error("three")
+	w.Close()
+
+	if len(requests) != 2 || len(requests[0]) != 6 || len(requests[1]) != 2 {
+		t.Fatal(requests)
+	}
+	index := `{"index":{"_index":"app-` + time.Now().Format("2006.01.02") + `"}}`
+	if requests[0][0] != index {
+		t.Fatal(requests[0][0])
+	}
+	var doc ElasticDocument
+	json.Unmarshal([]byte(requests[1][1]), &doc)
+	if doc.Level != "warning" || doc.Message != "two" || doc.Prefix != "api" || doc.Label != "lable" || !strings.HasSuffix(doc.Caller, "elastic_test.go") {
+		t.Fatal(requests[1][1])
+	}
+
+	bs, _ := ioutil.ReadFile(deadLetter)
+	if strings.Count(string(bs), "\n") != 1 || !strings.Contains(string(bs), "mapper_parsing_exception") || !strings.Contains(string(bs), `"message":"three"`) {
+		t.Fatal(string(bs))
+	}
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "1 items rejected") {
+		t.Fatal(errs)
+	}
+}
+
+// go test -run TestElasticDeadLetterError -v -count=1
+func TestElasticDeadLetterError(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	blocked := filepath.Join(dir, "blocked")
+	ioutil.WriteFile(blocked, nil, 0644)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"errors":true,"items":[{"index":{"status":400,"error":{"type":"mapper_parsing_exception"}}}]}`)
+	}))
+	defer ts.Close()
+
+	// 不能重试的日志写DeadLetter失败时两个错误都回调OnError
+	var errs []error
+	w := NewElasticWriter(&ElasticWriterOption{URL: ts.URL, Index: "app", BatchSize: 1, BatchWait: time.Hour, DeadLetter: filepath.Join(blocked, "dead.jsonl"), OnError: func(err error) { errs = append(errs, err) }})
+	NewLogger(w).Log2Error("lost")
+	w.Close()
+	if len(errs) != 2 || !strings.Contains(errs[0].Error(), "mapper_parsing_exception") || !strings.Contains(errs[1].Error(), "dead.jsonl") {
+		t.Fatal(errs)
+	}
+}
@@ -0,0 +1,341 @@
+package logger
+
+import (
+	"archive/zip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// EncryptedExt 加密的压缩文件在.zip后增加的扩展名
+const EncryptedExt = ".enc"
+
+// KeyProvider 压缩文件加密使用的AES密钥，密钥为16、24或32字节
+type KeyProvider interface {
+	EncryptionKey() (id string, key []byte, err error) // 加密新的压缩文件使用的密钥和密钥ID
+	DecryptionKey(id string) ([]byte, error)           // 按密钥ID返回解密使用的密钥，密钥轮换后仍然可以读取旧的压缩文件
+}
+
+// StaticKeys 固定的密钥，Current为加密使用的密钥ID
+type StaticKeys struct {
+	Current string
+	Keys    map[string][]byte
+}
+
+// EncryptionKey ...
+func (o *StaticKeys) EncryptionKey() (string, []byte, error) {
+	key, ok := o.Keys[o.Current]
+	if !ok {
+		return "", nil, fmt.Errorf("encryption key %q not found", o.Current)
+	}
+	return o.Current, key, nil
+}
+
+// DecryptionKey ...
+func (o *StaticKeys) DecryptionKey(id string) ([]byte, error) {
+	key, ok := o.Keys[id]
+	if !ok {
+		return nil, fmt.Errorf("decryption key %q not found", id)
+	}
+	return key, nil
+}
+
+// ParseStaticKeys 解析 id:hex 格式的密钥，多个密钥用逗号分隔，第一个密钥用于加密
+func ParseStaticKeys(s string) (*StaticKeys, error) {
+	o := &StaticKeys{Keys: map[string][]byte{}}
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		i := strings.IndexByte(v, ':')
+		if i <= 0 {
+			return nil, errors.New("key must be id:hex")
+		}
+		key, err := hex.DecodeString(v[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		if _, err := aes.NewCipher(key); err != nil {
+			return nil, err
+		}
+		if o.Current == "" {
+			o.Current = v[:i]
+		}
+		o.Keys[v[:i]] = key
+	}
+	return o, nil
+}
+
+// archiveKeys 读取加密压缩文件使用的密钥
+var archiveKeys struct {
+	sync.RWMutex
+	kp KeyProvider
+}
+
+// SetArchiveKeys 设置OpenLogFile、Query、HTTP日志浏览和VerifyArchives解密压缩文件使用的密钥
+func SetArchiveKeys(kp KeyProvider) {
+	archiveKeys.Lock()
+	defer archiveKeys.Unlock()
+	archiveKeys.kp = kp
+}
+
+func getArchiveKeys() KeyProvider {
+	archiveKeys.RLock()
+	defer archiveKeys.RUnlock()
+	return archiveKeys.kp
+}
+
+// 加密文件格式：
+//
+//	header: "LGENC1" | 密钥ID长度(1字节) | 密钥ID | 分块大小(4字节) | nonce前缀(7字节)
+//	chunk:  AES-GCM(分块明文)，nonce为 nonce前缀 | 分块序号(4字节) | 是否最后一块(1字节)，header为附加数据
+//
+// 除最后一块外每块明文都是分块大小，可以按位置解密任意一块，截断或调换分块都会解密失败
+const (
+	encMagic     = "LGENC1"
+	encChunkSize = 64 * 1024
+)
+
+var errEncFormat = errors.New("invalid encrypted archive")
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encNonce(prefix []byte, i uint32, last bool) []byte {
+	nonce := make([]byte, 12)
+	copy(nonce, prefix)
+	binary.BigEndian.PutUint32(nonce[7:], i)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
+
+// encryptFile 加密src写入dst
+func encryptFile(src, dst string, kp KeyProvider) error {
+	id, key, err := kp.EncryptionKey()
+	if err != nil {
+		return err
+	}
+	if len(id) > 255 {
+		return errors.New("key id too long")
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return err
+	}
+
+	header := append([]byte(encMagic), byte(len(id)))
+	header = append(header, id...)
+	header = append(header, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(header[len(header)-4:], encChunkSize)
+	prefix := make([]byte, 7)
+	if _, err := rand.Read(prefix); err != nil {
+		return err
+	}
+	header = append(header, prefix...)
+
+	fSrc, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer fSrc.Close()
+	fDst, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := fDst.Write(header); err != nil {
+		fDst.Close()
+		return err
+	}
+
+	// 多读一块才能知道当前块是不是最后一块
+	cur, next := make([]byte, encChunkSize), make([]byte, encChunkSize)
+	n, err := io.ReadFull(fSrc, cur)
+	for i := uint32(0); ; i++ {
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			fDst.Close()
+			return err
+		}
+		last := err != nil
+		var m int
+		if !last {
+			m, err = io.ReadFull(fSrc, next)
+			last = m == 0 && err == io.EOF
+		}
+		if _, e := fDst.Write(aead.Seal(nil, encNonce(prefix, i, last), cur[:n], header)); e != nil {
+			fDst.Close()
+			return e
+		}
+		if last {
+			break
+		}
+		cur, next, n = next, cur, m
+	}
+	return fDst.Close()
+}
+
+// encReader 按块解密的io.ReaderAt，用于zip.NewReader
+type encReader struct {
+	f      *os.File
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	chunk  int64 // 分块明文大小
+	body   int64 // header之后的密文大小
+	chunks int64
+	size   int64 // 明文大小
+
+	lock  sync.Mutex
+	index int64 // 缓存的分块
+	plain []byte
+}
+
+// openEncrypted 打开加密的压缩文件
+func openEncrypted(p string, kp KeyProvider) (*encReader, error) {
+	if kp == nil {
+		return nil, errors.New(p + ": encrypted archive requires SetArchiveKeys")
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	o, err := newEncReader(f, kp)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %v", p, err)
+	}
+	return o, nil
+}
+
+func newEncReader(f *os.File, kp KeyProvider) (*encReader, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	head := make([]byte, len(encMagic)+1)
+	if _, err := io.ReadFull(f, head); err != nil || string(head[:len(encMagic)]) != encMagic {
+		return nil, errEncFormat
+	}
+	rest := make([]byte, int(head[len(encMagic)])+4+7)
+	if _, err := io.ReadFull(f, rest); err != nil {
+		return nil, errEncFormat
+	}
+	header := append(head, rest...)
+	id := string(rest[:len(rest)-11])
+	key, err := kp.DecryptionKey(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &encReader{f: f, aead: aead, header: header, prefix: header[len(header)-7:], index: -1}
+	o.chunk = int64(binary.BigEndian.Uint32(header[len(header)-11:]))
+	o.body = fi.Size() - int64(len(header))
+	overhead := int64(aead.Overhead())
+	if o.chunk == 0 || o.body < overhead {
+		return nil, errEncFormat
+	}
+	o.chunks = (o.body + o.chunk + overhead - 1) / (o.chunk + overhead)
+	if o.body-(o.chunks-1)*(o.chunk+overhead) < overhead {
+		return nil, errEncFormat
+	}
+	o.size = o.body - o.chunks*overhead
+
+	// 解密最后一块，确认文件没有被截断
+	if err := o.load(o.chunks - 1); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// load 解密第i块，需要持有锁
+func (o *encReader) load(i int64) error {
+	if i == o.index {
+		return nil
+	}
+	overhead := int64(o.aead.Overhead())
+	off := i * (o.chunk + overhead)
+	n := o.chunk + overhead
+	if off+n > o.body {
+		n = o.body - off
+	}
+	buf := make([]byte, n)
+	if _, err := o.f.ReadAt(buf, int64(len(o.header))+off); err != nil {
+		return err
+	}
+	plain, err := o.aead.Open(buf[:0], encNonce(o.prefix, uint32(i), i == o.chunks-1), buf, o.header)
+	if err != nil {
+		return errEncFormat
+	}
+	o.index, o.plain = i, plain
+	return nil
+}
+
+// ReadAt ...
+func (o *encReader) ReadAt(p []byte, off int64) (int, error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	n := 0
+	for n < len(p) {
+		if off >= o.size {
+			return n, io.EOF
+		}
+		if err := o.load(off / o.chunk); err != nil {
+			return n, err
+		}
+		c := copy(p[n:], o.plain[off%o.chunk:])
+		n += c
+		off += int64(c)
+	}
+	return n, nil
+}
+
+// Close ...
+func (o *encReader) Close() error {
+	return o.f.Close()
+}
+
+// isArchive 是否是压缩文件，包括加密的压缩文件
+func isArchive(name string) bool {
+	return strings.HasSuffix(name, ".zip") || strings.HasSuffix(name, ".zip"+EncryptedExt)
+}
+
+// openArchive 打开压缩文件，加密的压缩文件使用SetArchiveKeys的密钥解密
+func openArchive(p string) (*zip.Reader, io.Closer, error) {
+	return openArchiveWith(p, getArchiveKeys())
+}
+
+func openArchiveWith(p string, kp KeyProvider) (*zip.Reader, io.Closer, error) {
+	if !strings.HasSuffix(p, EncryptedExt) {
+		zr, err := zip.OpenReader(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &zr.Reader, zr, nil
+	}
+	er, err := openEncrypted(p, kp)
+	if err != nil {
+		return nil, nil, err
+	}
+	zr, err := zip.NewReader(er, er.size)
+	if err != nil {
+		er.Close()
+		return nil, nil, err
+	}
+	return zr, er, nil
+}
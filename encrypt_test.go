@@ -0,0 +1,149 @@
+package logger
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ohko/logger/clock/clocktest"
+)
+
+var testKeys = &StaticKeys{Current: "k1", Keys: map[string][]byte{
+	"k1": bytes.Repeat([]byte{1}, 32),
+	"k2": bytes.Repeat([]byte{2}, 16),
+}}
+
+// go test -run TestEncryptFile -v -count=1
+func TestEncryptFile(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+
+	for _, size := range []int{0, 1, encChunkSize, encChunkSize + 1, 3 * encChunkSize} {
+		plain := make([]byte, size)
+		rand.Read(plain)
+		src, dst := filepath.Join(dir, "a.zip"), filepath.Join(dir, "a.zip.enc")
+		ioutil.WriteFile(src, plain, 0644)
+		if err := encryptFile(src, dst, testKeys); err != nil {
+			t.Fatal(size, err)
+		}
+		er, err := openEncrypted(dst, testKeys)
+		if err != nil {
+			t.Fatal(size, err)
+		}
+		got := make([]byte, er.size)
+		if n, err := er.ReadAt(got, 0); n != size || !bytes.Equal(got, plain) {
+			t.Fatal(size, n, err)
+		}
+		// 跨块读取
+		if size > 2*encChunkSize {
+			part := make([]byte, 10)
+			if _, err := er.ReadAt(part, encChunkSize-5); err != nil || !bytes.Equal(part, plain[encChunkSize-5:encChunkSize+5]) {
+				t.Fatal(size, err)
+			}
+		}
+		er.Close()
+	}
+
+	// 在分块边界截断、修改内容和缺少密钥都无法解密
+	dst := filepath.Join(dir, "a.zip.enc")
+	bs, _ := ioutil.ReadFile(dst)
+	header := len(encMagic) + 1 + len("k1") + 4 + 7
+	ioutil.WriteFile(dst, bs[:header+encChunkSize+16], 0644)
+	if _, err := openEncrypted(dst, testKeys); err == nil {
+		t.Fatal("truncated archive opened")
+	}
+	bs[len(bs)-1] ^= 1
+	ioutil.WriteFile(dst, bs, 0644)
+	if _, err := openEncrypted(dst, testKeys); err == nil {
+		t.Fatal("modified archive opened")
+	}
+	if _, err := openEncrypted(dst, &StaticKeys{Keys: map[string][]byte{}}); err == nil {
+		t.Fatal("opened without key")
+	}
+	if _, err := openEncrypted(dst, nil); err == nil {
+		t.Fatal("opened without key provider")
+	}
+}
+
+// go test -run TestParseStaticKeys -v -count=1
+func TestParseStaticKeys(t *testing.T) {
+	kp, err := ParseStaticKeys("k2:" + strings.Repeat("02", 16) + ", k1:" + strings.Repeat("01", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, key, _ := kp.EncryptionKey(); id != "k2" || !bytes.Equal(key, testKeys.Keys["k2"]) {
+		t.Fatal(id, key)
+	}
+	if key, _ := kp.DecryptionKey("k1"); !bytes.Equal(key, testKeys.Keys["k1"]) {
+		t.Fatal(key)
+	}
+	for _, s := range []string{"", "k1", ":00", "k1:zz", "k1:0011"} {
+		if _, err := ParseStaticKeys(s); err == nil {
+			t.Fatal(s)
+		}
+	}
+}
+
+// go test -run TestEncryptArchives -v -count=1
+func TestEncryptArchives(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	defer SetArchiveKeys(nil)
+
+	c := clocktest.New(time.Date(2019, 2, 10, 23, 59, 0, 0, time.UTC))
+	w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Name: "api_", CompressMode: ModeDay, Location: time.UTC, Clock: c, ArchiveKeys: testKeys})
+	l := NewLogger(w)
+	l.SetClock(c)
+	l.Log1Warn("secret")
+
+	// 第二天压缩并加密前一天的日志
+	c.BlockUntil(1)
+	c.Add(time.Minute)
+	c.BlockUntil(2)
+	c.Add(time.Minute)
+	archive := filepath.Join(dir, "2019", "02", "api_2019-02-10.zip.enc")
+	waitFor(t, "encrypted archive", func() bool {
+		return exists(archive) && !exists(filepath.Join(dir, "2019", "02", "api_2019-02-10.log"))
+	})
+	if bs, _ := ioutil.ReadFile(archive); bytes.Contains(bs, []byte("secret")) {
+		t.Fatal("archive not encrypted")
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "2019", "02", ".*.tmp")); len(files) != 0 {
+		t.Fatal(files)
+	}
+
+	// 没有密钥时只能校验SHA-256，不能读取
+	if result, err := VerifyArchives(dir); err != nil || len(result) != 1 || result[0].Err != nil {
+		t.Fatal(result, err)
+	}
+	if _, err := OpenLogFile(dir, "2019/02/api_2019-02-10.zip.enc", ""); err == nil {
+		t.Fatal("opened without key")
+	}
+
+	// 密钥轮换后使用旧的密钥ID读取
+	SetArchiveKeys(&StaticKeys{Current: "k2", Keys: testKeys.Keys})
+	var lines []string
+	if err := Query(dir, &QueryOption{Levels: []int{LoggerLevel1Warning}}, func(l *QueryLine) error {
+		lines = append(lines, l.File+" "+l.Message)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || lines[0] != "2019/02/api_2019-02-10.zip.enc secret" {
+		t.Fatal(lines)
+	}
+	files, _ := ListLogFiles(dir)
+	for _, f := range files {
+		if strings.HasSuffix(f.Path, ".enc") && (len(f.Entries) != 1 || f.Entries[0] != "api_2019-02-10.log") {
+			t.Fatal(f)
+		}
+	}
+	if result, _ := VerifyArchives(dir); len(result) != 1 || result[0].Err != nil {
+		t.Fatal(result)
+	}
+}
@@ -0,0 +1,52 @@
+package logger
+
+import (
+	"fmt"
+	"os"
+)
+
+// ErrorKind 日志系统内部错误的类型
+type ErrorKind string
+
+// ...
+const (
+	ErrorKindOpen        ErrorKind = "open"        // 打开日志文件失败
+	ErrorKindRotation    ErrorKind = "rotation"    // 切换到新的日志文件失败
+	ErrorKindCompression ErrorKind = "compression" // 压缩日志失败
+	ErrorKindRetention   ErrorKind = "retention"   // 删除过期日志失败
+	ErrorKindWrite       ErrorKind = "write"       // 写日志失败
+	ErrorKindNotify      ErrorKind = "notify"      // Monitor通知失败
+)
+
+// LoggerError 日志系统内部错误
+type LoggerError struct {
+	Kind ErrorKind // 错误类型
+	Path string    // 相关的文件或目录，可能为空
+	Err  error     // 原始错误
+}
+
+func (e *LoggerError) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("logger %s: %v", e.Kind, e.Err)
+	}
+	return fmt.Sprintf("logger %s %s: %v", e.Kind, e.Path, e.Err)
+}
+
+// Unwrap ...
+func (e *LoggerError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorHandler 接收日志系统内部错误，用于监控日志系统的状态
+// 为nil时错误输出到os.Stderr
+type ErrorHandler func(err *LoggerError)
+
+// handleError 调用handler，handler为nil时输出到os.Stderr
+func handleError(handler ErrorHandler, kind ErrorKind, path string, err error) {
+	e := &LoggerError{Kind: kind, Path: path, Err: err}
+	if handler == nil {
+		fmt.Fprintln(os.Stderr, e)
+		return
+	}
+	handler(e)
+}
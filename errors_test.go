@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// go test -run TestErrorHandler -v -count=1
+func TestErrorHandler(t *testing.T) {
+	var errs []*LoggerError
+	handler := func(err *LoggerError) { errs = append(errs, err) }
+
+	// Logger写失败
+	l := NewLogger(&failWriter{fail: 1})
+	l.SetErrorHandler(handler)
+	l.Log1Warn("fail")
+	l.Fork("fork").Log1Warn("ok")
+	if len(errs) != 1 || errs[0].Kind != ErrorKindWrite || errs[0].Unwrap().Error() != "broken pipe" {
+		t.Fatal(errs)
+	}
+
+	// Sink写失败
+	errs = nil
+	l.SetSinks(&Sink{MinLevel: LoggerLevel0Debug, MaxLevel: LoggerLevelNormal, Writer: &failWriter{fail: 1}})
+	l.Log1Warn("fail")
+	if len(errs) != 1 || errs[0].Kind != ErrorKindWrite {
+		t.Fatal(errs)
+	}
+
+	// 日志目录不可用时打开文件失败
+	errs = nil
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "file")
+	ioutil.WriteFile(file, nil, 0644)
+	w := NewDefaultWriter(&DefaultWriterOption{Path: file, ErrorHandler: handler, NoStderrFallback: true})
+	if len(errs) != 1 || errs[0].Kind != ErrorKindOpen || errs[0].Path == "" {
+		t.Fatal(errs)
+	}
+	if _, err := w.Write([]byte("x")); err != nil || !w.(*DefaultWriter).Degraded() {
+		t.Fatal(err)
+	}
+}
+
+// go test -race -run TestSetErrorHandlerRace -count=1
+func TestSetErrorHandlerRace(t *testing.T) {
+	l := NewLogger(ioutil.Discard)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			l.SetErrorHandler(func(err *LoggerError) {})
+			l.SetLogPath("log")
+		}
+	}()
+	for i := 0; i < 100; i++ {
+		l.Log1Warn("race")
+		l.getLogPath()
+	}
+	<-done
+}
+
+func TestMonitorErrorHandler(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	ioutil.WriteFile(filepath.Join(dir, "a.log"), []byte("0123456789"), 0644)
+
+	errs := make(chan *LoggerError, 1)
+	NewMonitor(&MonitorOption{
+		LogPath:        dir,
+		MaxSize:        5,
+		CustomCallback: func() error { return errors.New("notify failed") },
+		ErrorHandler:   func(err *LoggerError) { errs <- err },
+	})
+	select {
+	case err := <-errs:
+		if err.Kind != ErrorKindNotify || err.Path != dir || err.Err.Error() != "notify failed" {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+}
@@ -0,0 +1,148 @@
+package logger
+
+import (
+	"bytes"
+	"os"
+)
+
+// DefaultWriter的输出状态
+const (
+	WriterStatePrimary  = "primary"  // 正常写入日志目录
+	WriterStateFallback = "fallback" // 日志目录不可用，写入FallbackPath
+	WriterStateStderr   = "stderr"   // 日志目录和FallbackPath都不可用，写入os.Stderr
+	WriterStateMemory   = "memory"   // 都不可用，写入内存环形缓存，恢复后补写到日志目录
+)
+
+// memoryRing 内存环形缓存，超出大小时按行丢弃最早的日志
+type memoryRing struct {
+	size int
+	buf  []byte
+}
+
+func (o *memoryRing) Write(p []byte) (int, error) {
+	o.buf = append(o.buf, p...)
+	if over := len(o.buf) - o.size; over > 0 {
+		if i := bytes.IndexByte(o.buf[over:], '\n'); i >= 0 {
+			over += i + 1
+		}
+		if over > len(o.buf) {
+			over = len(o.buf)
+		}
+		o.buf = append(o.buf[:0], o.buf[over:]...)
+	}
+	return len(p), nil
+}
+
+// deferError 持有锁时记录错误，释放锁后由flushErrors回调
+func (o *DefaultWriter) deferError(kind ErrorKind, err error) {
+	o.pending = append(o.pending, deferredError{kind, err})
+}
+
+type deferredError struct {
+	kind ErrorKind
+	err  error
+}
+
+// flushErrors 释放锁后回调记录的错误，回调中可以再写日志
+func (o *DefaultWriter) flushErrors() {
+	o.lock.Lock()
+	errs := o.pending
+	o.pending = nil
+	o.lock.Unlock()
+	for _, e := range errs {
+		o.handleError(e.kind, e.err)
+	}
+}
+
+// State 返回当前的输出状态 [primary|fallback|stderr|memory]
+func (o *DefaultWriter) State() string {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.state
+}
+
+// Degraded 日志目录不可用，正在使用备用输出
+func (o *DefaultWriter) Degraded() bool {
+	return o.State() != WriterStatePrimary
+}
+
+// MemoryLogs 返回内存环形缓存中还没有补写到日志目录的日志
+func (o *DefaultWriter) MemoryLogs() []byte {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return append([]byte(nil), o.ring.buf...)
+}
+
+// degrade 日志目录不可用，RetryInterval后重试
+func (o *DefaultWriter) degrade() {
+	if o.state == WriterStatePrimary {
+		o.state = WriterStateFallback
+	}
+	o.retryAt = o.option.Clock.Now().Add(o.option.RetryInterval)
+}
+
+// retry 降级后每RetryInterval重新打开日志目录的文件
+func (o *DefaultWriter) retry() {
+	o.fallbackFailed = false
+	o.open()
+}
+
+// recover 恢复写入日志目录，补写内存中的日志
+func (o *DefaultWriter) recover() {
+	o.state = WriterStatePrimary
+	if o.fallbackHandle != nil {
+		o.fallbackHandle.Close()
+		o.fallbackHandle = nil
+	}
+	if len(o.ring.buf) > 0 {
+		// 审计日志模式下逐行加入审计链
+		data, head := o.ring.buf, []byte(nil)
+		if o.audit != nil {
+			data, head = o.audit.sealLines(o.ring.buf)
+		}
+		n, err := o.fileHandle.Write(data)
+		o.size += int64(n)
+		if err == nil {
+			o.ring.buf = o.ring.buf[:0]
+			if o.audit != nil {
+				if err := o.audit.commit(head); err != nil {
+					o.deferError(ErrorKindWrite, err)
+				}
+			}
+		}
+	}
+}
+
+// writeFallback 依次尝试FallbackPath、os.Stderr和内存环形缓存
+func (o *DefaultWriter) writeFallback(p []byte) (int, error) {
+	if o.option.FallbackPath != "" {
+		// 打开失败后等到下次重试时再打开
+		if o.fallbackHandle == nil && !o.fallbackFailed {
+			nc, err := openLogFile(o.logFile(o.option.FallbackPath))
+			if err != nil {
+				o.fallbackFailed = true
+				o.deferError(ErrorKindOpen, err)
+			} else {
+				o.fallbackHandle = nc
+			}
+		}
+		if o.fallbackHandle != nil {
+			if _, err := o.fallbackHandle.Write(p); err == nil {
+				o.state = WriterStateFallback
+				return len(p), nil
+			}
+			o.fallbackHandle.Close()
+			o.fallbackHandle, o.fallbackFailed = nil, true
+		}
+	}
+
+	if !o.option.NoStderrFallback {
+		if _, err := os.Stderr.Write(p); err == nil {
+			o.state = WriterStateStderr
+			return len(p), nil
+		}
+	}
+
+	o.state = WriterStateMemory
+	return o.ring.Write(p)
+}
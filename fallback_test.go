@@ -0,0 +1,70 @@
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// go test -run TestFallback -v -count=1
+func TestFallbackPath(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	blocked := filepath.Join(dir, "blocked")
+	ioutil.WriteFile(blocked, nil, 0644)
+
+	var errs []*LoggerError
+	w := NewDefaultWriter(&DefaultWriterOption{Path: blocked, FallbackPath: filepath.Join(dir, "fallback"), ErrorHandler: func(err *LoggerError) { errs = append(errs, err) }}).(*DefaultWriter)
+	l := NewLogger(w)
+	l.Log1Warn("to fallback")
+	if w.State() != WriterStateFallback || !w.Degraded() || len(errs) != 1 {
+		t.Fatal(w.State(), errs)
+	}
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "fallback", time.Now().Format("2006/01/2006-01-02.log")))
+	if err != nil || !strings.Contains(string(bs), "to fallback") {
+		t.Fatal(err, string(bs))
+	}
+}
+
+func TestFallbackMemory(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	blocked := filepath.Join(dir, "blocked")
+	ioutil.WriteFile(blocked, nil, 0644)
+
+	w := NewDefaultWriter(&DefaultWriterOption{Path: blocked, NoStderrFallback: true, RetryInterval: time.Millisecond * 10, ErrorHandler: func(*LoggerError) {}}).(*DefaultWriter)
+	l := NewLogger(w)
+	l.Log1Warn("in memory")
+	if w.State() != WriterStateMemory || !strings.Contains(string(w.MemoryLogs()), "in memory") {
+		t.Fatal(w.State(), string(w.MemoryLogs()))
+	}
+
+	// 日志目录恢复后补写内存中的日志
+	os.Remove(blocked)
+	time.Sleep(time.Millisecond * 20)
+	l.Log1Warn("recovered")
+	if w.State() != WriterStatePrimary || len(w.MemoryLogs()) != 0 {
+		t.Fatal(w.State())
+	}
+	bs, _ := ioutil.ReadFile(filepath.Join(blocked, time.Now().Format("2006/01/2006-01-02.log")))
+	if s := string(bs); strings.Index(s, "in memory") < 0 || strings.Index(s, "in memory") > strings.Index(s, "recovered") {
+		t.Fatal(s)
+	}
+}
+
+func TestMemoryRing(t *testing.T) {
+	r := &memoryRing{size: 10}
+	r.Write([]byte("1234\n"))
+	r.Write([]byte("5678\n"))
+	r.Write([]byte("abc\n"))
+	if string(r.buf) != "5678\nabc\n" {
+		t.Fatal(string(r.buf))
+	}
+	r.Write([]byte("0123456789abcdef\n"))
+	if string(r.buf) != "" {
+		t.Fatal(string(r.buf))
+	}
+}
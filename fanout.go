@@ -0,0 +1,140 @@
+package logger
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// FanoutWriterOption ...
+type FanoutWriterOption struct {
+	OnError       func(error)   // 输出写失败的回调，参数为*FanoutError
+	ErrorInterval time.Duration // 同一个输出两次回调的最小间隔，期间的错误只计数，默认1分钟
+	MaxFailures   int           // 连续失败多少次后暂停该输出，默认0不暂停
+	RetryInterval time.Duration // 暂停的输出多久后重试，默认1分钟
+}
+
+// FanoutError 一个输出的写错误
+type FanoutError struct {
+	Index      int       // 输出的序号
+	Writer     io.Writer // 输出
+	Err        error     // 写错误
+	Suppressed int       // 上次回调后因限流没有回调的错误数
+	Disabled   bool      // 输出已暂停，RetryInterval后重试
+}
+
+func (e *FanoutError) Error() string {
+	s := fmt.Sprintf("fanout output %d: %v", e.Index, e.Err)
+	if e.Suppressed > 0 {
+		s += fmt.Sprintf(" (%d more suppressed)", e.Suppressed)
+	}
+	if e.Disabled {
+		s += " (disabled)"
+	}
+	return s
+}
+
+// Unwrap ...
+func (e *FanoutError) Unwrap() error {
+	return e.Err
+}
+
+// errFanoutFailed 所有输出都失败或已暂停
+var errFanoutFailed = errors.New("fanout: all outputs failed")
+
+type fanoutOutput struct {
+	w          io.Writer
+	failures   int       // 连续失败次数
+	disabled   time.Time // 暂停到这个时间
+	reported   time.Time // 上次回调的时间
+	suppressed int
+}
+
+// FanoutWriter 把日志写入多个输出，与io.MultiWriter不同，一个输出失败不影响其它输出
+// 失败的输出按ErrorInterval限流回调OnError，连续失败MaxFailures次后暂停，RetryInterval后重试
+// 只有所有输出都失败时Write才返回错误
+type FanoutWriter struct {
+	option  *FanoutWriterOption
+	lock    sync.Mutex
+	outputs []*fanoutOutput
+}
+
+// NewFanoutWriter ...
+func NewFanoutWriter(option *FanoutWriterOption, writers ...io.Writer) *FanoutWriter {
+	o := &FanoutWriter{option: option}
+	if o.option == nil {
+		o.option = &FanoutWriterOption{}
+	}
+	if o.option.ErrorInterval <= 0 {
+		o.option.ErrorInterval = time.Minute
+	}
+	if o.option.MaxFailures < 0 {
+		o.option.MaxFailures = 0
+	}
+	if o.option.RetryInterval <= 0 {
+		o.option.RetryInterval = time.Minute
+	}
+	for _, w := range writers {
+		if w != nil {
+			o.outputs = append(o.outputs, &fanoutOutput{w: w})
+		}
+	}
+	return o
+}
+
+// Write ...
+func (o *FanoutWriter) Write(p []byte) (n int, err error) {
+	o.lock.Lock()
+	now := time.Now()
+	ok := false
+	var errs []error
+	for i, out := range o.outputs {
+		if now.Before(out.disabled) {
+			continue
+		}
+		n, err := out.w.Write(p)
+		if err == nil && n != len(p) {
+			err = io.ErrShortWrite
+		}
+		if err == nil {
+			out.failures, out.disabled = 0, time.Time{}
+			ok = true
+			continue
+		}
+		if e := o.fail(i, out, err, now); e != nil {
+			errs = append(errs, e)
+		}
+	}
+	o.lock.Unlock()
+
+	// 在锁外回调，回调中可以再写日志
+	for _, e := range errs {
+		o.option.OnError(e)
+	}
+	if !ok && len(o.outputs) > 0 {
+		return 0, errFanoutFailed
+	}
+	return len(p), nil
+}
+
+// fail 记录失败，返回需要回调的错误，按ErrorInterval限流
+func (o *FanoutWriter) fail(i int, out *fanoutOutput, err error, now time.Time) error {
+	out.failures++
+	disabled := false
+	if o.option.MaxFailures > 0 && out.failures >= o.option.MaxFailures {
+		out.disabled = now.Add(o.option.RetryInterval)
+		disabled = true
+	}
+	if o.option.OnError == nil {
+		return nil
+	}
+	if !disabled && now.Sub(out.reported) < o.option.ErrorInterval {
+		out.suppressed++
+		return nil
+	}
+	e := &FanoutError{Index: i, Writer: out.w, Err: err, Suppressed: out.suppressed, Disabled: disabled}
+	out.reported, out.suppressed = now, 0
+	return e
+}
@@ -0,0 +1,112 @@
+package logger
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// failWriter 前fail次写失败
+type failWriter struct {
+	fail   int
+	writes int
+	buf    bytes.Buffer
+}
+
+func (o *failWriter) Write(p []byte) (int, error) {
+	o.writes++
+	if o.fail != 0 {
+		o.fail--
+		return 0, errors.New("broken pipe")
+	}
+	return o.buf.Write(p)
+}
+
+// go test -run TestFanout -v -count=1
+func TestFanoutWriter(t *testing.T) {
+	good, bad := &bytes.Buffer{}, &failWriter{fail: -1}
+	var errs []*FanoutError
+	w := NewFanoutWriter(&FanoutWriterOption{OnError: func(err error) { errs = append(errs, err.(*FanoutError)) }}, bad, good)
+	for i := 0; i < 3; i++ {
+		if n, err := w.Write([]byte("x\n")); n != 2 || err != nil {
+			t.Fatal(n, err)
+		}
+	}
+	if good.String() != "x\nx\nx\n" {
+		t.Fatal(good.String())
+	}
+	// 限流: 只回调第一次
+	if len(errs) != 1 || errs[0].Index != 0 || errs[0].Disabled || !strings.Contains(errs[0].Error(), "broken pipe") {
+		t.Fatal(errs)
+	}
+
+	// 全部失败时返回错误
+	if _, err := NewFanoutWriter(nil, &failWriter{fail: -1}).Write([]byte("x")); err == nil {
+		t.Fatal("no error")
+	}
+}
+
+func TestFanoutWriterDisable(t *testing.T) {
+	bad := &failWriter{fail: 2}
+	var errs []*FanoutError
+	w := NewFanoutWriter(&FanoutWriterOption{
+		OnError:       func(err error) { errs = append(errs, err.(*FanoutError)) },
+		ErrorInterval: time.Hour,
+		MaxFailures:   2,
+		RetryInterval: time.Millisecond * 50,
+	}, bad)
+
+	w.Write([]byte("1"))
+	w.Write([]byte("2"))
+	// 暂停期间不写入
+	w.Write([]byte("3"))
+	if bad.writes != 2 || len(errs) != 2 || errs[0].Disabled || !errs[1].Disabled || errs[1].Suppressed != 0 {
+		t.Fatal(bad.writes, errs)
+	}
+
+	// 重试成功后恢复
+	time.Sleep(time.Millisecond * 60)
+	w.Write([]byte("4"))
+	w.Write([]byte("5"))
+	if bad.buf.String() != "45" {
+		t.Fatal(bad.buf.String())
+	}
+}
+
+func TestDefaultWriterClone(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+
+	var errs []error
+	w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Clone: &failWriter{fail: -1}, CloneOption: &FanoutWriterOption{OnError: func(err error) { errs = append(errs, err) }}})
+	l := NewLogger(w)
+	l.Log1Warn("still written")
+	if len(errs) != 1 {
+		t.Fatal(errs)
+	}
+
+	bs, err := ioutil.ReadFile(dir + time.Now().Format("/2006/01/2006-01-02.log"))
+	if err != nil || !strings.Contains(string(bs), "still written") {
+		t.Fatal(err, string(bs))
+	}
+}
+
+func TestDefaultWriterCloneErrorHandler(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+
+	// 没有CloneOption时Clone失败通过ErrorHandler回调
+	var errs []*LoggerError
+	w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Clone: &failWriter{fail: -1}, ErrorHandler: func(err *LoggerError) { errs = append(errs, err) }})
+	NewLogger(w).Log1Warn("clone failed")
+	if len(errs) != 1 || errs[0].Kind != ErrorKindWrite {
+		t.Fatal(errs)
+	}
+	if _, ok := errs[0].Err.(*FanoutError); !ok {
+		t.Fatal(errs[0].Err)
+	}
+}
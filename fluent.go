@@ -0,0 +1,253 @@
+package logger
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/ohko/logger/internal/msgpack"
+	"github.com/ohko/logger/parser"
+)
+
+// ...
+const (
+	FluentModeMessage = "message" // 每条日志一个 [tag, time, record, option]
+	FluentModePacked  = "packed"  // 每批日志一个 [tag, packed entries, option]
+)
+
+// FluentWriterOption ...
+type FluentWriterOption struct {
+	Network    string                 // 网络类型 [tcp|tls|unix]，默认tcp
+	Addr       string                 // fluentd/fluent-bit forward地址，默认127.0.0.1:24224
+	TLSConfig  *tls.Config            // tls连接的配置
+	TagPrefix  string                 // tag前缀，tag为 TagPrefix.日志前缀，默认logger
+	Mode       string                 // 发送模式 [message|packed]，默认packed
+	RequireAck bool                   // 发送chunk并等待服务器返回ack
+	Fields     map[string]interface{} // 附加到每条日志的字段
+	BatchSize  int                    // 每批最多的日志条数，默认100
+	BatchWait  time.Duration          // 每批最长的等待时间，默认1秒
+	BufferSize int                    // 等待发送的最多日志条数，超出后丢弃，默认10000
+	MaxRetries int                    // 失败重试次数，默认3次
+	MinBackoff time.Duration          // 第一次重试的等待时间，默认500毫秒
+	MaxBackoff time.Duration          // 最长的重试等待时间，默认10秒
+	Timeout    time.Duration          // 连接、写和等待ack的超时，默认10秒
+	OnError    func(error)            // 发送失败的回调
+}
+
+// FluentWriter 使用Fluentd forward协议发送日志
+type FluentWriter struct {
+	option *FluentWriterOption
+	batch  *batcher
+	lock   sync.Mutex
+	conn   net.Conn
+	dec    *msgpack.Decoder
+}
+
+// NewFluentWriter ...
+func NewFluentWriter(option *FluentWriterOption) *FluentWriter {
+	o := &FluentWriter{option: option}
+	if o.option == nil {
+		o.option = &FluentWriterOption{}
+	}
+	if o.option.Network == "" {
+		o.option.Network = "tcp"
+	}
+	if o.option.Addr == "" {
+		o.option.Addr = "127.0.0.1:24224"
+	}
+	if o.option.TagPrefix == "" {
+		o.option.TagPrefix = "logger"
+	}
+	if o.option.Mode == "" {
+		o.option.Mode = FluentModePacked
+	}
+	if o.option.BatchSize <= 0 {
+		o.option.BatchSize = 100
+	}
+	if o.option.BatchWait <= 0 {
+		o.option.BatchWait = time.Second
+	}
+	if o.option.BufferSize <= 0 {
+		o.option.BufferSize = 10000
+	}
+	if o.option.MaxRetries <= 0 {
+		o.option.MaxRetries = 3
+	}
+	if o.option.MinBackoff <= 0 {
+		o.option.MinBackoff = time.Millisecond * 500
+	}
+	if o.option.MaxBackoff <= 0 {
+		o.option.MaxBackoff = time.Second * 10
+	}
+	if o.option.Timeout <= 0 {
+		o.option.Timeout = time.Second * 10
+	}
+	o.batch = newBatcher(o.option.BatchSize, o.option.BatchWait, o.option.BufferSize, o.push)
+	o.batch.onError = o.option.OnError
+	return o
+}
+
+// Write 每次Write是一条Logger日志
+func (o *FluentWriter) Write(p []byte) (n int, err error) {
+	if err := o.batch.add(newSinkEntry(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close 发送剩余的日志后关闭连接
+func (o *FluentWriter) Close() error {
+	o.batch.close()
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.conn == nil {
+		return nil
+	}
+	err := o.conn.Close()
+	o.conn = nil
+	return err
+}
+
+func (o *FluentWriter) tag(e *sinkEntry) string {
+	if e.Prefix == "" {
+		return o.option.TagPrefix
+	}
+	return o.option.TagPrefix + "." + e.Prefix
+}
+
+func (o *FluentWriter) record(e *sinkEntry) map[string]interface{} {
+	r := map[string]interface{}{}
+	for k, v := range o.option.Fields {
+		r[k] = v
+	}
+	r["message"] = e.Message
+	r["level"] = parser.LevelName(e.Level)
+	if e.Prefix != "" {
+		r["prefix"] = e.Prefix
+	}
+	if e.Caller != "" {
+		r["caller"] = e.Caller
+		r["line"] = e.Line
+	}
+	return r
+}
+
+func (o *FluentWriter) push(entries []*sinkEntry) error {
+	// 按tag分组，保持日志顺序
+	var tags []string
+	groups := map[string][]*sinkEntry{}
+	for _, e := range entries {
+		tag := o.tag(e)
+		if _, ok := groups[tag]; !ok {
+			tags = append(tags, tag)
+		}
+		groups[tag] = append(groups[tag], e)
+	}
+
+	// option放在最后单独处理，需要ack时加入chunk
+	type message struct {
+		msg    []interface{}
+		option map[string]interface{}
+	}
+	var msgs []message
+	for _, tag := range tags {
+		if o.option.Mode == FluentModeMessage {
+			for _, e := range groups[tag] {
+				msgs = append(msgs, message{msg: []interface{}{tag, msgpack.EventTime(e.Time), o.record(e)}})
+			}
+			continue
+		}
+		var packed []byte
+		for _, e := range groups[tag] {
+			var err error
+			if packed, err = msgpack.Append(packed, []interface{}{msgpack.EventTime(e.Time), o.record(e)}); err != nil {
+				return err
+			}
+		}
+		msgs = append(msgs, message{msg: []interface{}{tag, packed}, option: map[string]interface{}{"size": len(groups[tag])}})
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for _, msg := range msgs {
+		if err := o.send(msg.msg, msg.option); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// send 发送一个forward消息，RequireAck时等待服务器返回相同的chunk
+func (o *FluentWriter) send(msg []interface{}, option map[string]interface{}) error {
+	chunk := ""
+	if o.option.RequireAck {
+		id := make([]byte, 16)
+		rand.Read(id)
+		chunk = base64.StdEncoding.EncodeToString(id)
+		if option == nil {
+			option = map[string]interface{}{}
+		}
+		option["chunk"] = chunk
+	}
+	if option != nil {
+		msg = append(msg, option)
+	}
+	b, err := msgpack.Append(nil, msg)
+	if err != nil {
+		return err
+	}
+
+	return retry(retryOption{o.option.MaxRetries, o.option.MinBackoff, o.option.MaxBackoff}, func() (bool, error) {
+		if err := o.connect(); err != nil {
+			return true, err
+		}
+		o.conn.SetDeadline(time.Now().Add(o.option.Timeout))
+		if _, err := o.conn.Write(b); err != nil {
+			o.disconnect()
+			return true, err
+		}
+		if chunk == "" {
+			return false, nil
+		}
+		v, err := o.dec.Decode()
+		if err != nil {
+			o.disconnect()
+			return true, err
+		}
+		if m, ok := v.(map[string]interface{}); !ok || m["ack"] != chunk {
+			o.disconnect()
+			return true, fmt.Errorf("fluent: invalid ack %v", v)
+		}
+		return false, nil
+	})
+}
+
+func (o *FluentWriter) connect() error {
+	if o.conn != nil {
+		return nil
+	}
+	var err error
+	d := &net.Dialer{Timeout: o.option.Timeout}
+	if o.option.Network == "tls" {
+		o.conn, err = tls.DialWithDialer(d, "tcp", o.option.Addr, o.option.TLSConfig)
+	} else {
+		o.conn, err = d.Dial(o.option.Network, o.option.Addr)
+	}
+	if err != nil {
+		o.conn = nil
+		return err
+	}
+	o.dec = msgpack.NewDecoder(o.conn)
+	return nil
+}
+
+func (o *FluentWriter) disconnect() {
+	if o.conn != nil {
+		o.conn.Close()
+		o.conn, o.dec = nil, nil
+	}
+}
@@ -0,0 +1,117 @@
+package logger
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ohko/logger/internal/msgpack"
+)
+
+// fluentServer 模拟fluentd的forward input，badAcks个消息返回错误的ack
+func fluentServer(t *testing.T, badAcks int) (net.Listener, chan []interface{}) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msgs := make(chan []interface{}, 100)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				dec := msgpack.NewDecoder(conn)
+				for {
+					v, err := dec.Decode()
+					if err != nil {
+						return
+					}
+					msg := v.([]interface{})
+					option, _ := msg[len(msg)-1].(map[string]interface{})
+					if chunk, ok := option["chunk"]; ok {
+						if badAcks > 0 {
+							badAcks--
+							chunk = "bad"
+						} else {
+							msgs <- msg
+						}
+						b, _ := msgpack.Append(nil, map[string]interface{}{"ack": chunk})
+						conn.Write(b)
+						continue
+					}
+					msgs <- msg
+				}
+			}(conn)
+		}
+	}()
+	return ln, msgs
+}
+
+func fluentRecv(t *testing.T, msgs chan []interface{}) []interface{} {
+	select {
+	case msg := <-msgs:
+		return msg
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+	return nil
+}
+
+// go test -run TestFluent -v -count=1
+func TestFluentPacked(t *testing.T) {
+	ln, msgs := fluentServer(t, 1)
+	defer ln.Close()
+
+	w := NewFluentWriter(&FluentWriterOption{Addr: ln.Addr().String(), RequireAck: true, BatchWait: time.Millisecond * 50, MinBackoff: time.Millisecond * 10, Fields: map[string]interface{}{"app": "test"}})
+	l := NewLogger(w)
+	l.SetPrefix("api")
+	l.Log2Error("hello")
+	l.Log1Warn("world")
+	w.Close()
+
+	// 第一次ack错误，重连后重发
+	msg := fluentRecv(t, msgs)
+	if len(msg) != 3 || msg[0] != "logger.api" || msg[2].(map[string]interface{})["size"] != int64(2) {
+		t.Fatal(msg)
+	}
+	dec := msgpack.NewDecoder(bytes.NewReader(msg[1].([]byte)))
+	var records []map[string]interface{}
+	for {
+		v, err := dec.Decode()
+		if err != nil {
+			break
+		}
+		e := v.([]interface{})
+		if ext, ok := e[0].(msgpack.Ext); !ok || ext.Type != 0 || len(ext.Data) != 8 {
+			t.Fatal(e[0])
+		}
+		records = append(records, e[1].(map[string]interface{}))
+	}
+	if len(records) != 2 || records[0]["message"] != "hello" || records[0]["level"] != "error" || records[0]["app"] != "test" ||
+		!strings.HasSuffix(records[0]["caller"].(string), "fluent_test.go") || records[1]["message"] != "world" || records[1]["level"] != "warning" {
+		t.Fatal(records)
+	}
+}
+
+func TestFluentMessage(t *testing.T) {
+	ln, msgs := fluentServer(t, 0)
+	defer ln.Close()
+
+	w := NewFluentWriter(&FluentWriterOption{Addr: ln.Addr().String(), Mode: FluentModeMessage, TagPrefix: "app", RequireAck: true, BatchWait: time.Millisecond * 50})
+	l := NewLogger(w)
+	l.Log0Debug("no prefix")
+	w.Close()
+
+	msg := fluentRecv(t, msgs)
+	if len(msg) != 4 || msg[0] != "app" || msg[3].(map[string]interface{})["chunk"] == nil {
+		t.Fatal(msg)
+	}
+	if r := msg[2].(map[string]interface{}); r["message"] != "no prefix" || r["level"] != "debug" || r["prefix"] != nil {
+		t.Fatal(r)
+	}
+}
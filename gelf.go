@@ -0,0 +1,224 @@
+package logger
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ...
+const (
+	GELFCompressGzip = "gzip" // UDP默认使用gzip压缩
+	GELFCompressZlib = "zlib"
+	GELFCompressNone = "none"
+)
+
+// GELFWriterOption ...
+type GELFWriterOption struct {
+	Network   string                 // 网络类型 [udp|tcp|tls]，默认udp
+	Addr      string                 // Graylog GELF input地址，默认127.0.0.1:12201
+	TLSConfig *tls.Config            // tls连接的配置
+	Host      string                 // host字段，默认os.Hostname()
+	Compress  string                 // UDP压缩方式 [gzip|zlib|none]，默认gzip
+	ChunkSize int                    // UDP分块大小，默认1420
+	Fields    map[string]interface{} // 附加字段，输出为_key
+	Timeout   time.Duration          // 连接和写超时，默认5秒
+}
+
+// GELFWriter 以GELF格式发送日志到Graylog
+// 多行日志的第一行作为short_message，完整内容作为full_message
+// 日志前缀、调用者和Fields作为_开头的附加字段
+type GELFWriter struct {
+	option *GELFWriterOption
+	lock   sync.Mutex
+	conn   net.Conn
+}
+
+// NewGELFWriter ...
+func NewGELFWriter(option *GELFWriterOption) *GELFWriter {
+	o := &GELFWriter{option: option}
+	if o.option == nil {
+		o.option = &GELFWriterOption{}
+	}
+	if o.option.Network == "" {
+		o.option.Network = "udp"
+	}
+	if o.option.Addr == "" {
+		o.option.Addr = "127.0.0.1:12201"
+	}
+	if o.option.Host == "" {
+		o.option.Host, _ = os.Hostname()
+	}
+	if o.option.Compress == "" {
+		o.option.Compress = GELFCompressGzip
+	}
+	if o.option.ChunkSize <= 12 {
+		o.option.ChunkSize = 1420
+	}
+	if o.option.Timeout <= 0 {
+		o.option.Timeout = time.Second * 5
+	}
+	return o
+}
+
+// GELFMessage 把一条Logger日志转换为GELF 1.1格式
+func (o *GELFWriter) GELFMessage(p []byte) map[string]interface{} {
+	e := newSinkEntry(p)
+	msg := strings.TrimRight(e.Message, "\n")
+	short := msg
+	if i := strings.IndexByte(msg, '\n'); i >= 0 {
+		short = msg[:i]
+	}
+	t := e.Time
+	if !e.Entry.Time.IsZero() {
+		t = e.Entry.Time
+	}
+
+	m := map[string]interface{}{}
+	for k, v := range o.option.Fields {
+		if !strings.HasPrefix(k, "_") {
+			k = "_" + k
+		}
+		// _id是GELF保留字段
+		if k != "_id" {
+			m[k] = v
+		}
+	}
+	m["version"] = "1.1"
+	m["host"] = o.option.Host
+	m["short_message"] = short
+	if short != msg {
+		m["full_message"] = msg
+	}
+	m["timestamp"] = float64(t.UnixNano()/int64(time.Millisecond)) / 1000
+	m["level"] = SyslogSeverity(e.Level)
+	if e.Prefix != "" {
+		m["_prefix"] = e.Prefix
+	}
+	if e.Caller != "" {
+		m["_caller"] = e.Caller + ":" + strconv.Itoa(e.Line)
+		m["_file"] = e.Caller
+		m["_line"] = e.Line
+	}
+	return m
+}
+
+// Write 每次Write是一条Logger日志
+func (o *GELFWriter) Write(p []byte) (n int, err error) {
+	msg, err := json.Marshal(o.GELFMessage(p))
+	if err != nil {
+		return 0, err
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.option.Network == "udp" {
+		err = o.writeUDP(msg)
+	} else {
+		// TCP不压缩，以\0分隔，失败时重连重试一次
+		for i := 0; i < 2; i++ {
+			if err = o.connect(); err != nil {
+				break
+			}
+			o.conn.SetWriteDeadline(time.Now().Add(o.option.Timeout))
+			if _, err = o.conn.Write(append(msg, 0)); err == nil {
+				break
+			}
+			o.conn.Close()
+			o.conn = nil
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (o *GELFWriter) connect() error {
+	if o.conn != nil {
+		return nil
+	}
+	var err error
+	d := &net.Dialer{Timeout: o.option.Timeout}
+	if o.option.Network == "tls" {
+		o.conn, err = tls.DialWithDialer(d, "tcp", o.option.Addr, o.option.TLSConfig)
+	} else {
+		o.conn, err = d.Dial(o.option.Network, o.option.Addr)
+	}
+	if err != nil {
+		o.conn = nil
+	}
+	return err
+}
+
+func (o *GELFWriter) writeUDP(msg []byte) error {
+	if err := o.connect(); err != nil {
+		return err
+	}
+
+	switch o.option.Compress {
+	case GELFCompressGzip, GELFCompressZlib:
+		buf := bytes.NewBuffer(nil)
+		var w io.WriteCloser
+		if o.option.Compress == GELFCompressGzip {
+			w = gzip.NewWriter(buf)
+		} else {
+			w = zlib.NewWriter(buf)
+		}
+		w.Write(msg)
+		w.Close()
+		msg = buf.Bytes()
+	}
+
+	if len(msg) <= o.option.ChunkSize {
+		_, err := o.conn.Write(msg)
+		return err
+	}
+
+	// 分块: 0x1e 0x0f + 8字节消息ID + 序号 + 总数，最多128块
+	size := o.option.ChunkSize - 12
+	count := (len(msg) + size - 1) / size
+	if count > 128 {
+		return errors.New("gelf: message too large")
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	for i := 0; i < count; i++ {
+		end := (i + 1) * size
+		if end > len(msg) {
+			end = len(msg)
+		}
+		chunk := make([]byte, 0, 12+end-i*size)
+		chunk = append(chunk, 0x1e, 0x0f)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(i), byte(count))
+		chunk = append(chunk, msg[i*size:end]...)
+		if _, err := o.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close ...
+func (o *GELFWriter) Close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.conn == nil {
+		return nil
+	}
+	err := o.conn.Close()
+	o.conn = nil
+	return err
+}
@@ -0,0 +1,87 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"strings"
+	"testing"
+)
+
+// go test -run TestGELF -v -count=1
+func TestGELFUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	w := NewGELFWriter(&GELFWriterOption{Addr: pc.LocalAddr().String(), Host: "host", ChunkSize: 100, Fields: map[string]interface{}{"app": "test", "id": 1}})
+	defer w.Close()
+	l := NewLogger(w)
+	l.SetPrefix("api")
+	l.Log2Error("first line\n" + strings.Repeat("x", 2000))
+
+	// 接收并合并分块
+	chunks := map[byte][]byte{}
+	count := 0
+	buf := make([]byte, 2048)
+	for count == 0 || len(chunks) < count {
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf[0] != 0x1e || buf[1] != 0x0f {
+			t.Fatal("not chunked")
+		}
+		count = int(buf[11])
+		chunks[buf[10]] = append([]byte{}, buf[12:n]...)
+	}
+	data := bytes.NewBuffer(nil)
+	for i := 0; i < count; i++ {
+		data.Write(chunks[byte(i)])
+	}
+	zr, err := gzip.NewReader(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := ioutil.ReadAll(zr)
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(bs, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["version"] != "1.1" || m["host"] != "host" || m["short_message"] != "first line" || !strings.HasSuffix(m["full_message"].(string), "xxx") ||
+		m["level"].(float64) != 3 || m["_prefix"] != "api" || m["_app"] != "test" || m["_id"] != nil || m["id"] != nil || !strings.Contains(m["_caller"].(string), "gelf_test.go:") {
+		t.Fatal(string(bs))
+	}
+}
+
+func TestGELFTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	msgs := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		s, _ := bufio.NewReader(conn).ReadString(0)
+		msgs <- s
+	}()
+
+	w := NewGELFWriter(&GELFWriterOption{Network: "tcp", Addr: ln.Addr().String()})
+	defer w.Close()
+	NewLogger(w).Log1Warn("warning")
+	msg := <-msgs
+	if !strings.HasSuffix(msg, "}\x00") || !strings.Contains(msg, `"short_message":"warning"`) || !strings.Contains(msg, `"level":4`) || strings.Contains(msg, "full_message") {
+		t.Fatal(msg)
+	}
+}
@@ -0,0 +1,396 @@
+// Package msgpack 实现Fluentd forward协议需要的MessagePack编码和解码
+// https://github.com/msgpack/msgpack/blob/master/spec.md
+package msgpack
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// Ext 扩展类型
+type Ext struct {
+	Type int8
+	Data []byte
+}
+
+// EventTime Fluentd的EventTime扩展类型(type 0)，秒和纳秒
+func EventTime(t time.Time) Ext {
+	data := make([]byte, 8)
+	binary.BigEndian.PutUint32(data, uint32(t.Unix()))
+	binary.BigEndian.PutUint32(data[4:], uint32(t.Nanosecond()))
+	return Ext{Type: 0, Data: data}
+}
+
+// Append 把v编码后追加到b
+// 支持nil、bool、整数、浮点数、string、[]byte、[]interface{}、map[string]interface{}、time.Time和Ext
+func Append(b []byte, v interface{}) ([]byte, error) {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case int:
+		return appendInt(b, int64(v)), nil
+	case int8:
+		return appendInt(b, int64(v)), nil
+	case int16:
+		return appendInt(b, int64(v)), nil
+	case int32:
+		return appendInt(b, int64(v)), nil
+	case int64:
+		return appendInt(b, v), nil
+	case uint:
+		return appendUint(b, uint64(v)), nil
+	case uint8:
+		return appendUint(b, uint64(v)), nil
+	case uint16:
+		return appendUint(b, uint64(v)), nil
+	case uint32:
+		return appendUint(b, uint64(v)), nil
+	case uint64:
+		return appendUint(b, v), nil
+	case float32:
+		b = append(b, 0xca)
+		return appendBE32(b, math.Float32bits(v)), nil
+	case float64:
+		b = append(b, 0xcb)
+		return appendBE64(b, math.Float64bits(v)), nil
+	case string:
+		return AppendString(b, v), nil
+	case []byte:
+		return AppendBinary(b, v), nil
+	case time.Time:
+		return Append(b, EventTime(v))
+	case Ext:
+		return appendExt(b, v), nil
+	case []interface{}:
+		b = AppendArrayHeader(b, len(v))
+		for _, item := range v {
+			var err error
+			if b, err = Append(b, item); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	case map[string]interface{}:
+		// 按key排序，保证编码结果稳定
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = AppendMapHeader(b, len(v))
+		for _, k := range keys {
+			b = AppendString(b, k)
+			var err error
+			if b, err = Append(b, v[k]); err != nil {
+				return b, err
+			}
+		}
+		return b, nil
+	case map[string]string:
+		m := make(map[string]interface{}, len(v))
+		for k, s := range v {
+			m[k] = s
+		}
+		return Append(b, m)
+	case fmt.Stringer:
+		return AppendString(b, v.String()), nil
+	case error:
+		return AppendString(b, v.Error()), nil
+	}
+	return b, fmt.Errorf("msgpack: unsupported type %T", v)
+}
+
+func appendInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return appendUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt8:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return appendBE16(append(b, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		return appendBE32(append(b, 0xd2), uint32(v))
+	}
+	return appendBE64(append(b, 0xd3), uint64(v))
+}
+
+func appendUint(b []byte, v uint64) []byte {
+	switch {
+	case v <= 0x7f:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return appendBE16(append(b, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return appendBE32(append(b, 0xce), uint32(v))
+	}
+	return appendBE64(append(b, 0xcf), v)
+}
+
+// AppendString ...
+func AppendString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = appendBE16(append(b, 0xda), uint16(n))
+	default:
+		b = appendBE32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+// AppendBinary ...
+func AppendBinary(b []byte, data []byte) []byte {
+	n := len(data)
+	switch {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = appendBE16(append(b, 0xc5), uint16(n))
+	default:
+		b = appendBE32(append(b, 0xc6), uint32(n))
+	}
+	return append(b, data...)
+}
+
+// AppendArrayHeader ...
+func AppendArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return appendBE16(append(b, 0xdc), uint16(n))
+	}
+	return appendBE32(append(b, 0xdd), uint32(n))
+}
+
+// AppendMapHeader ...
+func AppendMapHeader(b []byte, n int) []byte {
+	switch {
+	case n < 16:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return appendBE16(append(b, 0xde), uint16(n))
+	}
+	return appendBE32(append(b, 0xdf), uint32(n))
+}
+
+func appendExt(b []byte, e Ext) []byte {
+	n := len(e.Data)
+	switch n {
+	case 1:
+		b = append(b, 0xd4)
+	case 2:
+		b = append(b, 0xd5)
+	case 4:
+		b = append(b, 0xd6)
+	case 8:
+		b = append(b, 0xd7)
+	case 16:
+		b = append(b, 0xd8)
+	default:
+		switch {
+		case n <= math.MaxUint8:
+			b = append(b, 0xc7, byte(n))
+		case n <= math.MaxUint16:
+			b = appendBE16(append(b, 0xc8), uint16(n))
+		default:
+			b = appendBE32(append(b, 0xc9), uint32(n))
+		}
+	}
+	b = append(b, byte(e.Type))
+	return append(b, e.Data...)
+}
+
+// ErrFormat ...
+var ErrFormat = errors.New("msgpack: invalid format")
+
+// Decoder 从io.Reader中解码
+// map解码为map[string]interface{}，数组为[]interface{}，整数为int64/uint64，bin为[]byte
+type Decoder struct {
+	r *bufio.Reader
+}
+
+// NewDecoder ...
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// Decode 解码一个值
+func (d *Decoder) Decode() (interface{}, error) {
+	c, err := d.r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return d.decodeMap(int(c & 0x0f))
+	case c&0xf0 == 0x90:
+		return d.decodeArray(int(c & 0x0f))
+	case c&0xe0 == 0xa0:
+		bs, err := d.read(int(c & 0x1f))
+		return string(bs), err
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := d.readLen(c - 0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return d.read(n)
+	case 0xc7, 0xc8, 0xc9:
+		n, err := d.readLen(c - 0xc7)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeExt(n)
+	case 0xca:
+		bs, err := d.read(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(bs))), nil
+	case 0xcb:
+		bs, err := d.read(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(bs)), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		bs, err := d.read(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return beUint(bs), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		bs, err := d.read(1 << (c - 0xd0))
+		if err != nil {
+			return nil, err
+		}
+		v := beUint(bs)
+		shift := 64 - 8*uint(len(bs))
+		return int64(v<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		return d.decodeExt(1 << (c - 0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := d.readLen(c - 0xd9)
+		if err != nil {
+			return nil, err
+		}
+		bs, err := d.read(n)
+		return string(bs), err
+	case 0xdc, 0xdd:
+		n, err := d.readLen(c - 0xdc + 1)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeArray(n)
+	case 0xde, 0xdf:
+		n, err := d.readLen(c - 0xde + 1)
+		if err != nil {
+			return nil, err
+		}
+		return d.decodeMap(n)
+	}
+	return nil, ErrFormat
+}
+
+func beUint(bs []byte) uint64 {
+	var v uint64
+	for _, b := range bs {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+// readLen 读取1/2/4字节的长度，size为0/1/2
+func (d *Decoder) readLen(size byte) (int, error) {
+	bs, err := d.read(1 << size)
+	if err != nil {
+		return 0, err
+	}
+	return int(beUint(bs)), nil
+}
+
+func (d *Decoder) read(n int) ([]byte, error) {
+	bs := make([]byte, n)
+	_, err := io.ReadFull(d.r, bs)
+	return bs, err
+}
+
+func (d *Decoder) decodeExt(n int) (interface{}, error) {
+	bs, err := d.read(n + 1)
+	if err != nil {
+		return nil, err
+	}
+	return Ext{Type: int8(bs[0]), Data: bs[1:]}, nil
+}
+
+func (d *Decoder) decodeArray(n int) (interface{}, error) {
+	a := make([]interface{}, n)
+	for i := range a {
+		v, err := d.Decode()
+		if err != nil {
+			return nil, err
+		}
+		a[i] = v
+	}
+	return a, nil
+}
+
+func (d *Decoder) decodeMap(n int) (interface{}, error) {
+	m := make(map[string]interface{}, n)
+	for i := 0; i < n; i++ {
+		k, err := d.Decode()
+		if err != nil {
+			return nil, err
+		}
+		v, err := d.Decode()
+		if err != nil {
+			return nil, err
+		}
+		m[fmt.Sprint(k)] = v
+	}
+	return m, nil
+}
+
+func appendBE16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendBE32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func appendBE64(b []byte, v uint64) []byte {
+	return appendBE32(appendBE32(b, uint32(v>>32)), uint32(v))
+}
@@ -0,0 +1,40 @@
+package msgpack
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAppendDecode(t *testing.T) {
+	tm := time.Unix(1549072800, 123)
+	v := []interface{}{
+		nil, true, false,
+		int64(0), int64(127), int64(-1), int64(-33), int64(-200), int64(-40000), int64(-3000000000),
+		uint64(200), uint64(60000), uint64(4000000000), uint64(1 << 40),
+		1.5, "", "tag", strings.Repeat("s", 40), strings.Repeat("s", 300), strings.Repeat("s", 70000),
+		[]byte("bin"),
+		EventTime(tm),
+		map[string]interface{}{"a": int64(1), "b": []interface{}{"x", int64(2)}},
+	}
+	b, err := Append(nil, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewDecoder(bytes.NewReader(b)).Decode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, v) {
+		t.Fatalf("%#v", got)
+	}
+
+	// 整数统一解码为int64/uint64
+	b, _ = Append(nil, map[string]interface{}{"n": 5, "s": map[string]string{"k": "v"}})
+	got, _ = NewDecoder(bytes.NewReader(b)).Decode()
+	if !reflect.DeepEqual(got, map[string]interface{}{"n": int64(5), "s": map[string]interface{}{"k": "v"}}) {
+		t.Fatalf("%#v", got)
+	}
+}
@@ -0,0 +1,161 @@
+// Package snappy 实现snappy block格式的编码和解码，用于Loki的protobuf推送接口
+// https://github.com/google/snappy/blob/master/format_description.txt
+package snappy
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	tagLiteral = 0x00
+	tagCopy1   = 0x01
+	tagCopy2   = 0x02
+	tagCopy4   = 0x03
+)
+
+// ErrCorrupt ...
+var ErrCorrupt = errors.New("snappy: corrupt input")
+
+// Encode 压缩src，使用2字节偏移的copy，匹配窗口为64KB
+func Encode(src []byte) []byte {
+	dst := make([]byte, binary.MaxVarintLen64, len(src)+len(src)/6+32)
+	dst = dst[:binary.PutUvarint(dst, uint64(len(src)))]
+
+	var table [1 << 14]int
+	lit := 0
+	for i := 0; i+4 <= len(src); {
+		v := binary.LittleEndian.Uint32(src[i:])
+		h := (v * 0x1e35a7bd) >> 18
+		cand := table[h] - 1
+		table[h] = i + 1
+		if cand < 0 || i-cand > 0xffff || binary.LittleEndian.Uint32(src[cand:]) != v {
+			i++
+			continue
+		}
+
+		dst = emitLiteral(dst, src[lit:i])
+		n := 4
+		for i+n < len(src) && src[cand+n] == src[i+n] {
+			n++
+		}
+		dst = emitCopy(dst, i-cand, n)
+		i += n
+		lit = i
+	}
+	return emitLiteral(dst, src[lit:])
+}
+
+func emitLiteral(dst, lit []byte) []byte {
+	if len(lit) == 0 {
+		return dst
+	}
+	n := len(lit) - 1
+	switch {
+	case n < 60:
+		dst = append(dst, byte(n)<<2|tagLiteral)
+	case n < 1<<8:
+		dst = append(dst, 60<<2|tagLiteral, byte(n))
+	case n < 1<<16:
+		dst = append(dst, 61<<2|tagLiteral, byte(n), byte(n>>8))
+	case n < 1<<24:
+		dst = append(dst, 62<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16))
+	default:
+		dst = append(dst, 63<<2|tagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+	}
+	return append(dst, lit...)
+}
+
+func emitCopy(dst []byte, offset, length int) []byte {
+	// 每个copy最长64字节，最后一段至少4字节
+	for length >= 68 {
+		dst = append(dst, 63<<2|tagCopy2, byte(offset), byte(offset>>8))
+		length -= 64
+	}
+	if length > 64 {
+		dst = append(dst, 59<<2|tagCopy2, byte(offset), byte(offset>>8))
+		length -= 60
+	}
+	return append(dst, byte(length-1)<<2|tagCopy2, byte(offset), byte(offset>>8))
+}
+
+// Decode 解压snappy block格式的数据
+func Decode(src []byte) ([]byte, error) {
+	size, n := binary.Uvarint(src)
+	if n <= 0 || size > 1<<32 {
+		return nil, ErrCorrupt
+	}
+	src = src[n:]
+	dst := make([]byte, 0, size)
+	for len(src) > 0 {
+		tag := src[0]
+		switch tag & 0x03 {
+		case tagLiteral:
+			length := int(tag >> 2)
+			src = src[1:]
+			if length >= 60 {
+				w := length - 59
+				if len(src) < w {
+					return nil, ErrCorrupt
+				}
+				length = 0
+				for i := w - 1; i >= 0; i-- {
+					length = length<<8 | int(src[i])
+				}
+				src = src[w:]
+			}
+			length++
+			if len(src) < length {
+				return nil, ErrCorrupt
+			}
+			dst = append(dst, src[:length]...)
+			src = src[length:]
+			continue
+		case tagCopy1:
+			if len(src) < 2 {
+				return nil, ErrCorrupt
+			}
+			length := 4 + int(tag>>2)&0x07
+			offset := int(tag&0xe0)<<3 | int(src[1])
+			src = src[2:]
+			if dst, n = copyBack(dst, offset, length); n < 0 {
+				return nil, ErrCorrupt
+			}
+		case tagCopy2:
+			if len(src) < 3 {
+				return nil, ErrCorrupt
+			}
+			length := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint16(src[1:]))
+			src = src[3:]
+			if dst, n = copyBack(dst, offset, length); n < 0 {
+				return nil, ErrCorrupt
+			}
+		case tagCopy4:
+			if len(src) < 5 {
+				return nil, ErrCorrupt
+			}
+			length := 1 + int(tag>>2)
+			offset := int(binary.LittleEndian.Uint32(src[1:]))
+			src = src[5:]
+			if dst, n = copyBack(dst, offset, length); n < 0 {
+				return nil, ErrCorrupt
+			}
+		}
+	}
+	if uint64(len(dst)) != size {
+		return nil, ErrCorrupt
+	}
+	return dst, nil
+}
+
+func copyBack(dst []byte, offset, length int) ([]byte, int) {
+	if offset <= 0 || offset > len(dst) {
+		return dst, -1
+	}
+	// 逐字节复制，支持重叠
+	for i := 0; i < length; i++ {
+		dst = append(dst, dst[len(dst)-offset])
+	}
+	return dst, length
+}
@@ -0,0 +1,34 @@
+package snappy
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	inputs := [][]byte{
+		nil,
+		[]byte("a"),
+		[]byte("2019/02/02 10:00:00 /src/a.go:10: [api:D]debug\n"),
+		bytes.Repeat([]byte("2019/02/02 10:00:00 /src/a.go:10: [api:D]debug\n"), 1000),
+		bytes.Repeat([]byte{'x'}, 100000),
+	}
+	random := make([]byte, 70000)
+	rand.Read(random)
+	inputs = append(inputs, random)
+
+	for _, in := range inputs {
+		enc := Encode(in)
+		dec, err := Decode(enc)
+		if err != nil {
+			t.Fatal(len(in), err)
+		}
+		if !bytes.Equal(in, dec) {
+			t.Fatal(len(in), "mismatch")
+		}
+	}
+	if enc := Encode(inputs[3]); len(enc) > len(inputs[3])/10 {
+		t.Fatal("not compressed", len(enc))
+	}
+}
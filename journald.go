@@ -0,0 +1,178 @@
+package logger
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/ohko/logger/parser"
+)
+
+// JournaldWriterOption ...
+type JournaldWriterOption struct {
+	Socket     string            // journald socket，默认/run/systemd/journal/socket
+	Identifier string            // 日志前缀为空时使用的SYSLOG_IDENTIFIER，默认为进程名
+	Fields     map[string]string // 附加到每条日志的字段，字段名转换为大写
+}
+
+// JournaldWriter 使用native协议把日志发送到systemd-journald
+// 日志前缀作为SYSLOG_IDENTIFIER，调用者作为CODE_FILE/CODE_LINE
+// 超过socket限制的日志通过memfd发送
+type JournaldWriter struct {
+	option *JournaldWriterOption
+	lock   sync.Mutex
+	conn   *net.UnixConn
+	fields []string
+}
+
+// NewJournaldWriter ...
+func NewJournaldWriter(option *JournaldWriterOption) *JournaldWriter {
+	o := &JournaldWriter{option: option}
+	if o.option == nil {
+		o.option = &JournaldWriterOption{}
+	}
+	if o.option.Socket == "" {
+		o.option.Socket = "/run/systemd/journal/socket"
+	}
+	if o.option.Identifier == "" {
+		o.option.Identifier = filepath.Base(os.Args[0])
+	}
+	for k := range o.option.Fields {
+		o.fields = append(o.fields, k)
+	}
+	sort.Strings(o.fields)
+	return o
+}
+
+// JournaldFieldName 转换为journald的字段名: 大写字母、数字和下划线，不能以下划线或数字开头
+func JournaldFieldName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		}
+		return '_'
+	}, name)
+	name = strings.TrimLeft(name, "_0123456789")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	return name
+}
+
+// appendJournaldField 不含换行的值为 NAME=value\n
+// 含换行的值为 NAME\n + 64位小端长度 + value + \n
+func appendJournaldField(b []byte, name, value string) []byte {
+	if name == "" {
+		return b
+	}
+	if !strings.ContainsRune(value, '\n') {
+		b = append(b, name...)
+		b = append(b, '=')
+		b = append(b, value...)
+		return append(b, '\n')
+	}
+	b = append(b, name...)
+	b = append(b, '\n')
+	var size [8]byte
+	binary.LittleEndian.PutUint64(size[:], uint64(len(value)))
+	b = append(b, size[:]...)
+	b = append(b, value...)
+	return append(b, '\n')
+}
+
+// JournaldMessage 把一条Logger日志转换为native协议的数据
+func (o *JournaldWriter) JournaldMessage(p []byte) []byte {
+	e := newSinkEntry(p)
+	identifier := e.Prefix
+	if identifier == "" {
+		identifier = o.option.Identifier
+	}
+
+	var b []byte
+	for _, k := range o.fields {
+		b = appendJournaldField(b, JournaldFieldName(k), o.option.Fields[k])
+	}
+	b = appendJournaldField(b, "MESSAGE", strings.TrimRight(e.Message, "\n"))
+	b = appendJournaldField(b, "PRIORITY", strconv.Itoa(SyslogSeverity(e.Level)))
+	b = appendJournaldField(b, "SYSLOG_IDENTIFIER", identifier)
+	b = appendJournaldField(b, "LOGGER_LEVEL", parser.LevelName(e.Level))
+	if e.Prefix != "" {
+		b = appendJournaldField(b, "LOGGER_PREFIX", e.Prefix)
+	}
+	if e.Caller != "" {
+		b = appendJournaldField(b, "CODE_FILE", e.Caller)
+		b = appendJournaldField(b, "CODE_LINE", strconv.Itoa(e.Line))
+	}
+	return b
+}
+
+// Write 每次Write是一条Logger日志
+func (o *JournaldWriter) Write(p []byte) (n int, err error) {
+	msg := o.JournaldMessage(p)
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	// 写失败时重连重试一次，journald重启后原来的连接不可用
+	for i := 0; i < 2; i++ {
+		if err = o.connect(); err != nil {
+			return 0, err
+		}
+		if _, err = o.conn.Write(msg); err == nil {
+			return len(p), nil
+		}
+		if isMsgTooLarge(err) {
+			if err = journaldSendFd(o.conn, msg); err != nil {
+				return 0, err
+			}
+			return len(p), nil
+		}
+		o.conn.Close()
+		o.conn = nil
+	}
+	return 0, err
+}
+
+func (o *JournaldWriter) connect() error {
+	if o.conn != nil {
+		return nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: o.option.Socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	o.conn = conn
+	return nil
+}
+
+// isMsgTooLarge 数据报超过socket的发送限制
+func isMsgTooLarge(err error) bool {
+	if e, ok := err.(*net.OpError); ok {
+		err = e.Err
+	}
+	if e, ok := err.(*os.SyscallError); ok {
+		err = e.Err
+	}
+	return err == syscall.EMSGSIZE || err == syscall.ENOBUFS
+}
+
+// Close ...
+func (o *JournaldWriter) Close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.conn == nil {
+		return nil
+	}
+	err := o.conn.Close()
+	o.conn = nil
+	return err
+}
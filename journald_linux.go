@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// memfd_create的系统调用号，旧的syscall包中没有全部平台的定义
+var sysMemfdCreate = map[string]uintptr{
+	"386":     356,
+	"amd64":   319,
+	"arm":     385,
+	"arm64":   279,
+	"loong64": 279,
+	"mips64":  5314,
+	"ppc64":   360,
+	"ppc64le": 360,
+	"riscv64": 279,
+	"s390x":   350,
+}
+
+const (
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+	fAddSeals       = 1033
+	fSealAll        = 0x1 | 0x2 | 0x4 | 0x8 // SEAL | SHRINK | GROW | WRITE
+)
+
+// journaldSendFd 把日志写入memfd并密封后，通过SCM_RIGHTS发送文件描述符
+// 不支持memfd时使用/dev/shm中已删除的临时文件
+func journaldSendFd(conn *net.UnixConn, msg []byte) error {
+	f, err := memfdCreate("logger-journald")
+	if err != nil {
+		if f, err = ioutil.TempFile("/dev/shm", "logger-journald-"); err != nil {
+			return err
+		}
+		os.Remove(f.Name())
+	}
+	defer f.Close()
+
+	if _, err := f.Write(msg); err != nil {
+		return err
+	}
+	// memfd必须密封，journald才会接受；临时文件忽略错误
+	syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), fAddSeals, fSealAll)
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(f.Fd()))
+	if e := rc.Write(func(fd uintptr) bool {
+		err = syscall.Sendmsg(int(fd), nil, rights, nil, 0)
+		return err != syscall.EAGAIN
+	}); e != nil {
+		return e
+	}
+	return err
+}
+
+func memfdCreate(name string) (*os.File, error) {
+	trap, ok := sysMemfdCreate[runtime.GOARCH]
+	if !ok {
+		return nil, syscall.ENOSYS
+	}
+	p, err := syscall.BytePtrFromString(name)
+	if err != nil {
+		return nil, err
+	}
+	fd, _, errno := syscall.Syscall(trap, uintptr(unsafe.Pointer(p)), mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, errno
+	}
+	return os.NewFile(fd, name), nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package logger
+
+import (
+	"errors"
+	"net"
+)
+
+// journaldSendFd journald只在linux上运行
+func journaldSendFd(conn *net.UnixConn, msg []byte) error {
+	return errors.New("journald: message too large")
+}
@@ -0,0 +1,111 @@
+//go:build linux
+// +build linux
+
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// journaldServer 模拟journald的socket，返回解析后的字段
+func journaldServer(t *testing.T) (*net.UnixConn, string, func() map[string]string) {
+	dir, _ := ioutil.TempDir("", "logger")
+	socket := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	recv := func() map[string]string {
+		buf := make([]byte, 1<<16)
+		oob := make([]byte, 1024)
+		n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data := buf[:n]
+		if oobn > 0 {
+			// memfd发送的日志
+			msgs, _ := syscall.ParseSocketControlMessage(oob[:oobn])
+			fds, err := syscall.ParseUnixRights(&msgs[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			f := os.NewFile(uintptr(fds[0]), "memfd")
+			defer f.Close()
+			f.Seek(0, 0)
+			data, _ = ioutil.ReadAll(f)
+		}
+		return parseJournald(t, data)
+	}
+	return conn, socket, recv
+}
+
+func parseJournald(t *testing.T, data []byte) map[string]string {
+	fields := map[string]string{}
+	for len(data) > 0 {
+		i := bytes.IndexAny(data, "=\n")
+		if i < 0 {
+			t.Fatal(string(data))
+		}
+		name := string(data[:i])
+		if data[i] == '=' {
+			j := bytes.IndexByte(data, '\n')
+			fields[name] = string(data[i+1 : j])
+			data = data[j+1:]
+			continue
+		}
+		size := int(binary.LittleEndian.Uint64(data[i+1:]))
+		fields[name] = string(data[i+9 : i+9+size])
+		data = data[i+10+size:]
+	}
+	return fields
+}
+
+// go test -run TestJournald -v -count=1
+func TestJournald(t *testing.T) {
+	conn, socket, recv := journaldServer(t)
+	defer os.RemoveAll(filepath.Dir(socket))
+	defer conn.Close()
+
+	w := NewJournaldWriter(&JournaldWriterOption{Socket: socket, Identifier: "app", Fields: map[string]string{"request-id": "abc", "_bad": "x"}})
+	defer w.Close()
+	l := NewLogger(w)
+	l.SetPrefix("api")
+	l.Log2Error("first\nsecond")
+
+	m := recv()
+	if m["MESSAGE"] != "first\nsecond" || m["PRIORITY"] != "3" || m["SYSLOG_IDENTIFIER"] != "api" || m["LOGGER_PREFIX"] != "api" ||
+		m["LOGGER_LEVEL"] != "error" || m["REQUEST_ID"] != "abc" || m["BAD"] != "x" ||
+		!strings.HasSuffix(m["CODE_FILE"], "journald_test.go") || m["CODE_LINE"] == "" {
+		t.Fatal(m)
+	}
+
+	l.SetPrefix("")
+	l.Log0Debug("no prefix")
+	if m := recv(); m["SYSLOG_IDENTIFIER"] != "app" || m["PRIORITY"] != "7" || m["MESSAGE"] != "no prefix" {
+		t.Fatal(m)
+	}
+
+	// 超过socket限制时通过memfd发送
+	large := strings.Repeat("x", 1<<20)
+	l.Log1Warn(large)
+	if m := recv(); m["MESSAGE"] != large || m["PRIORITY"] != "4" {
+		t.Fatal(len(m["MESSAGE"]))
+	}
+}
+
+func TestJournaldFieldName(t *testing.T) {
+	for name, want := range map[string]string{"request-id": "REQUEST_ID", "_private": "PRIVATE", "1a": "A", "Code.File": "CODE_FILE"} {
+		if got := JournaldFieldName(name); got != want {
+			t.Fatal(name, got)
+		}
+	}
+}
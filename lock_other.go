@@ -0,0 +1,20 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package logger
+
+import "os"
+
+// windows不支持flock，多进程写同一个日志目录时不做协调
+
+func lockShared(f *os.File) error {
+	return nil
+}
+
+func lockExclusive(f *os.File) error {
+	return nil
+}
+
+func tryLock(f *os.File) bool {
+	return true
+}
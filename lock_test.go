@@ -0,0 +1,168 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package logger
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ohko/logger/clock/clocktest"
+)
+
+// go test -run TestMultiProcess -v -count=1
+func TestMultiProcessCompress(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	logFile := filepath.Join(dir, "2019-02-01.log")
+	zipFile := filepath.Join(dir, "2019-02-01.zip")
+
+	// 其它进程还在写日志时等待
+	f, err := openLogFile(logFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("line 1\n"))
+	done := make(chan error)
+	go func() { done <- compressAndRemoveFile(logFile, zipFile) }()
+	select {
+	case <-done:
+		t.Fatal("compressed while file is open")
+	case <-time.After(time.Millisecond * 50):
+	}
+	f.Write([]byte("line 2\n"))
+	f.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.OpenReader(zipFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc, _ := zr.File[0].Open()
+	bs, _ := ioutil.ReadAll(rc)
+	rc.Close()
+	zr.Close()
+	if string(bs) != "line 1\nline 2\n" {
+		t.Fatal(string(bs))
+	}
+
+	// 其它进程已经压缩过
+	os.Remove(zipFile)
+	if err := compressAndRemoveFile(logFile, zipFile); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(zipFile); !os.IsNotExist(err) {
+		t.Fatal("zip created")
+	}
+	if err := compressAndRemoveDir(filepath.Join(dir, "2019/01"), filepath.Join(dir, "2019-01.zip")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMultiProcessLockDir(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+
+	w1 := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app"}).(*DefaultWriter)
+	w2 := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app"}).(*DefaultWriter)
+	unlock, ok := w1.lockDir()
+	if !ok {
+		t.Fatal("lock failed")
+	}
+	// 其它DefaultWriter正在压缩时等待
+	done := make(chan func())
+	go func() {
+		unlock, _ := w2.lockDir()
+		done <- unlock
+	}()
+	select {
+	case <-done:
+		t.Fatal("locked twice")
+	case <-time.After(time.Millisecond * 50):
+	}
+	unlock()
+	if unlock := <-done; unlock == nil {
+		t.Fatal("lock failed")
+	} else {
+		unlock()
+	}
+
+	// 日志浏览不显示锁文件
+	files, _ := ListLogFiles(dir)
+	for _, f := range files {
+		if filepath.Base(f.Path) == ".logger.lock" {
+			t.Fatal(files)
+		}
+	}
+}
+
+// go test -run TestMultiNameCompress -v -count=1
+func TestMultiNameCompress(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+
+	// 同一个Label的多个Name同时切换日志文件，依次压缩各自的日志
+	c := clocktest.New(time.Date(2019, 2, 10, 23, 59, 0, 0, time.UTC))
+	var ws []*DefaultWriter
+	for _, name := range []string{"api_", "web_"} {
+		w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: name, CompressMode: ModeDay, Location: time.UTC, Clock: c, NoCurrentLink: true}).(*DefaultWriter)
+		w.Write([]byte(name + "\n"))
+		ws = append(ws, w)
+	}
+
+	unlock, ok := ws[0].lockDir()
+	if !ok {
+		t.Fatal("lock failed")
+	}
+	c.BlockUntil(2)
+	c.Add(time.Minute)
+	c.BlockUntil(4)
+	c.Add(time.Minute)
+	unlock()
+	waitFor(t, "day archives", func() bool {
+		return exists(dir+"/app/2019/02/api_2019-02-10.zip") && exists(dir+"/app/2019/02/web_2019-02-10.zip") &&
+			!exists(dir+"/app/2019/02/api_2019-02-10.log") && !exists(dir+"/app/2019/02/web_2019-02-10.log")
+	})
+}
+
+// go test -run TestAuditSingleWriter -v -count=1
+func TestAuditSingleWriter(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+
+	// 同一个Label的第二个审计日志DefaultWriter降级，不向审计链的目录写入没有哈希的日志
+	w1 := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: "a_", Audit: true, NoCurrentLink: true}).(*DefaultWriter)
+	var errs []*LoggerError
+	w2 := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: "b_", Audit: true, NoCurrentLink: true, NoStderrFallback: true, RetryInterval: time.Millisecond * 10, ErrorHandler: func(err *LoggerError) { errs = append(errs, err) }}).(*DefaultWriter)
+	if !w2.Degraded() || len(errs) != 1 || errs[0].Kind != ErrorKindOpen {
+		t.Fatal(w2.State(), errs)
+	}
+	w1.Write([]byte("from a\n"))
+	w2.Write([]byte("from b\n"))
+	if files, _ := filepath.Glob(filepath.Join(dir, "app", "*", "*", "b_*")); len(files) != 0 {
+		t.Fatal(files)
+	}
+
+	// 第一个DefaultWriter退出后继续审计链
+	w1.audit.state.Close()
+	time.Sleep(time.Millisecond * 20)
+	w2.Write([]byte("b recovered\n"))
+	if w2.Degraded() {
+		t.Fatal(w2.State())
+	}
+	if n, brk, err := VerifyAudit(filepath.Join(dir, "app"), nil); err != nil || brk != nil || n != 3 {
+		t.Fatal(n, brk, err)
+	}
+
+	// 其它Label不受影响
+	w3 := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "other", Name: "a_", Audit: true, NoCurrentLink: true}).(*DefaultWriter)
+	if w3.Degraded() {
+		t.Fatal(w3.State())
+	}
+}
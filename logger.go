@@ -9,6 +9,9 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
+
+	"github.com/ohko/logger/clock"
 )
 
 // ...
@@ -30,6 +33,12 @@ type Logger struct {
 	prefix string
 	lock   sync.RWMutex
 
+	logPath      string
+	router       *router
+	errorHandler ErrorHandler
+	clock        clock.Clock
+	outLock      *sync.Mutex // 设置了Clock时直接写SetOutput的输出，Fork共享
+
 	storePrefix map[int]string
 	forks       []*Logger
 }
@@ -42,8 +51,10 @@ func NewLogger(out io.Writer) *Logger {
 	}
 
 	o := &Logger{
-		level: &level,
-		l:     log.New(out, "", log.Ldate|log.Ltime|log.Llongfile),
+		level:   &level,
+		l:       log.New(out, "", log.Ldate|log.Ltime|log.Llongfile),
+		router:  &router{},
+		outLock: &sync.Mutex{},
 		storePrefix: map[int]string{
 			LoggerLevel0Debug:   "",
 			LoggerLevel1Warning: "",
@@ -69,7 +80,59 @@ func (o *Logger) LogCalldepth(calldepth int, level int, msg ...interface{}) {
 
 	o.lock.RLock()
 	defer o.lock.RUnlock()
-	o.l.Output(calldepth, o.storePrefix[level]+fmt.Sprint(msg...))
+	routed := o.router.enabled()
+	if !routed && o.clock == nil {
+		if err := o.l.Output(calldepth, o.storePrefix[level]+fmt.Sprint(msg...)); err != nil && o.errorHandler != nil {
+			handleError(o.errorHandler, ErrorKindWrite, "", err)
+		}
+		return
+	}
+
+	// 设置了Sink时按日志等级路由，设置了Clock时使用Clock的时间
+	f := formatterPool.Get().(*entryFormatter)
+	f.buf.Reset()
+	flag, prefix := o.l.Flags(), o.l.Prefix()
+	if o.clock != nil {
+		prefix += clockHeader(o.clock, flag)
+		flag &^= log.Ldate | log.Ltime | log.Lmicroseconds
+	}
+	f.l.SetFlags(flag)
+	f.l.SetPrefix(prefix)
+	f.l.Output(calldepth, o.storePrefix[level]+fmt.Sprint(msg...))
+	var errs []error
+	if routed {
+		errs = o.router.write(level, f.buf.Bytes())
+	} else {
+		o.outLock.Lock()
+		if _, err := o.l.Writer().Write(f.buf.Bytes()); err != nil {
+			errs = append(errs, err)
+		}
+		o.outLock.Unlock()
+	}
+	formatterPool.Put(f)
+	if o.errorHandler != nil {
+		for _, err := range errs {
+			handleError(o.errorHandler, ErrorKindWrite, "", err)
+		}
+	}
+}
+
+// clockHeader 使用Clock的时间生成与log.Ldate、log.Ltime、log.Lmicroseconds相同格式的日期和时间
+func clockHeader(c clock.Clock, flag int) string {
+	t := c.Now()
+	if flag&log.LUTC != 0 {
+		t = t.UTC()
+	}
+	s := ""
+	if flag&log.Ldate != 0 {
+		s += t.Format("2006/01/02 ")
+	}
+	if flag&log.Lmicroseconds != 0 {
+		s += t.Format("15:04:05.000000 ")
+	} else if flag&log.Ltime != 0 {
+		s += t.Format("15:04:05 ")
+	}
+	return s
 }
 
 // SetColor Enable/Disable color
@@ -118,6 +181,32 @@ func (o *Logger) SetOutput(w io.Writer) {
 	o.l.SetOutput(w)
 }
 
+// SetSinks 按日志等级路由到多个输出，设置后日志只输出到Sink，不再输出到SetOutput的输出
+// 不带参数调用时恢复使用SetOutput的输出，Fork出的Logger共享相同的Sink
+func (o *Logger) SetSinks(sinks ...*Sink) {
+	o.router.set(sinks)
+}
+
+// AddSink 增加一个Sink
+func (o *Logger) AddSink(sink *Sink) {
+	o.router.add(sink)
+}
+
+// SetErrorHandler 设置写日志失败的回调，默认忽略写日志的错误
+// 回调中不要使用同一个Logger写日志或调用SetErrorHandler，写日志一直失败时会无限递归
+func (o *Logger) SetErrorHandler(handler ErrorHandler) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.errorHandler = handler
+}
+
+// SetClock 设置日志时间的来源，默认使用系统时间，测试时使用clocktest.Clock
+func (o *Logger) SetClock(c clock.Clock) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.clock = c
+}
+
 // Log0Debug ...
 func (o *Logger) Log0Debug(v ...interface{}) {
 	o.LogCalldepth(3, LoggerLevel0Debug, fmt.Sprintln(v...))
@@ -149,8 +238,13 @@ func (o *Logger) Fork(prefix string) *Logger {
 	o.lock.RLock()
 	defer o.lock.RUnlock()
 	f := &Logger{
-		level: o.level,
-		l:     o.l,
+		level:        o.level,
+		l:            o.l,
+		logPath:      o.logPath,
+		router:       o.router,
+		errorHandler: o.errorHandler,
+		clock:        o.clock,
+		outLock:      o.outLock,
 		storePrefix: map[int]string{
 			LoggerLevel0Debug:   o.storePrefix[LoggerLevel0Debug],
 			LoggerLevel1Warning: o.storePrefix[LoggerLevel1Warning],
@@ -164,9 +258,41 @@ func (o *Logger) Fork(prefix string) *Logger {
 	return f
 }
 
+// SetLogPath 设置HTTP日志浏览的目录，默认使用DefaultWriter的日志目录
+func (o *Logger) SetLogPath(path string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.logPath = path
+}
+
+func (o *Logger) getLogPath() string {
+	o.lock.RLock()
+	path := o.logPath
+	o.lock.RUnlock()
+	if path != "" {
+		return path
+	}
+	if w, ok := o.l.Writer().(*DefaultWriter); ok {
+		return w.option.Path
+	}
+	return ""
+}
+
+// getLogLocation DefaultWriter日志文件名中日期的时区
+func (o *Logger) getLogLocation() *time.Location {
+	if w, ok := o.l.Writer().(*DefaultWriter); ok {
+		return w.option.Location
+	}
+	return time.Local
+}
+
 // Listen ...
 func (o *Logger) Listen(addr string) {
 	ms := http.NewServeMux()
+	if root := o.getLogPath(); root != "" {
+		handleLogs(ms, root)
+		handleQuery(ms, root, o.getLogLocation(), func(err error) { o.Log2Error(err) })
+	}
 	ms.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Add("Content-Type", "text/html; charset=utf-8")
 
@@ -194,6 +320,7 @@ const (
 	<label><input type="radio" name="level" value=4> Trace</label>
 	<label><input type="radio" name="level" value=5> Off</label>
 	<button>Update</button>
+	<a href="/logs">Logs</a>
 	<script>document.querySelector("input[value='{LEVEL}']").checked=true</script>
 </form>
 `
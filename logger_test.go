@@ -1,12 +1,17 @@
 package logger
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/ohko/logger/clock/clocktest"
 )
 
 // go test github.com/ohko/logger -run TestNewLogger -v -count=1
@@ -99,3 +104,205 @@ func TestSubMonth(t *testing.T) {
 		t.Fail()
 	}
 }
+
+// go test -run TestCurrentLink -v -count=1
+func TestCurrentLink(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+
+	w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: "api_"}).(*DefaultWriter)
+	l := NewLogger(w)
+	l.Log1Warn("current")
+
+	link := dir + "/app/current.log"
+	target, err := os.Readlink(link)
+	if err != nil || target != time.Now().Format("2006/01/api_2006-01-02.log") {
+		t.Fatal(target, err)
+	}
+	if bs, _ := ioutil.ReadFile(link); !strings.Contains(string(bs), "current") {
+		t.Fatal(string(bs))
+	}
+
+	// 切换后替换符号链接
+	w.option.Name = "web_"
+	if err := w.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	if target, _ := os.Readlink(link); target != time.Now().Format("2006/01/web_2006-01-02.log") {
+		t.Fatal(target)
+	}
+
+	// 查询和浏览时跳过符号链接
+	count := 0
+	Query(dir+"/app", nil, func(*QueryLine) error { count++; return nil })
+	files, _ := ListLogFiles(dir + "/app")
+	if count != 1 || len(files) != 2 {
+		t.Fatal(count, files)
+	}
+}
+
+// go test -run TestLocation -v -count=1
+func TestLocation(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+
+	// 夏令时开始的一天只有23小时，结束的一天有25小时
+	for _, c := range []struct {
+		day   string
+		hours time.Duration
+	}{
+		{"2019-03-10 08:00", 23},
+		{"2019-11-03 08:00", 25},
+		{"2019-06-15 08:00", 24},
+	} {
+		t0, _ := time.ParseInLocation("2006-01-02 15:04", c.day, ny)
+		start := time.Date(t0.Year(), t0.Month(), t0.Day(), 0, 0, 0, 0, ny)
+		next := nextDay(t0)
+		if next.Format("2006-01-02 15:04") != t0.AddDate(0, 0, 1).Format("2006-01-02")+" 00:00" || next.Sub(start) != c.hours*time.Hour {
+			t.Fatal(c.day, next, next.Sub(start))
+		}
+	}
+
+	// 夏令时在0点切换时，第二天从01:00开始
+	if santiago, err := time.LoadLocation("America/Santiago"); err == nil {
+		t0, _ := time.ParseInLocation("2006-01-02 15:04", "2019-09-07 12:00", santiago)
+		if next := nextDay(t0); next.Format("2006-01-02 15:04") != "2019-09-08 01:00" {
+			t.Fatal(next)
+		}
+	}
+
+	// 压缩和删除按日历天计算
+	t2, _ := time.ParseInLocation("2006-01-02", "2019-03-11", ny)
+	if d := daysBefore(t2, 1).Format("2006-01-02"); d != "2019-03-10" {
+		t.Fatal(d)
+	}
+	t2, _ = time.ParseInLocation("2006-01-02", "2019-11-04", ny)
+	if d := daysBefore(t2, 2).Format("2006-01-02"); d != "2019-11-02" {
+		t.Fatal(d)
+	}
+
+	// 按月删除使用配置的时区
+	t2, _ = time.ParseInLocation("2006-01-02", "2019-11-01", ny)
+	if m := subMoth(t2, 1); m.Location() != ny || m.Format("2006-01-02 15:04") != "2019-10-01 00:00" {
+		t.Fatal(m)
+	}
+	if m := subMoth(t2, 12); m.Format("2006-01-02") != "2018-11-01" {
+		t.Fatal(m)
+	}
+
+	// 文件名中的日期使用配置的时区
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	for _, loc := range []*time.Location{time.UTC, time.FixedZone("+14", 14*3600), time.FixedZone("-12", -12*3600)} {
+		w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Name: "api_", Location: loc, NoCurrentLink: true}).(*DefaultWriter)
+		if f := w.logFile(dir); !strings.HasSuffix(f, time.Now().In(loc).Format("2006-01-02.log")) {
+			t.Fatal(loc, f)
+		}
+	}
+}
+
+// go test -run TestLoggerClock -v -count=1
+func TestLoggerClock(t *testing.T) {
+	c := clocktest.New(time.Date(2019, 1, 2, 3, 4, 5, 6000, time.UTC))
+	buf := &bytes.Buffer{}
+	l := NewLogger(buf)
+	l.SetClock(c)
+	l.SetFlags(log.Ldate | log.Lmicroseconds | log.LUTC)
+	l.SetPrefix("api")
+	l.Log1Warn("hello")
+	if s := buf.String(); s != "2019/01/02 03:04:05.000006 [api:W]hello\n" {
+		t.Fatal(s)
+	}
+
+	// Fork和Sink使用相同的Clock
+	buf.Reset()
+	c.Add(time.Hour)
+	l.SetFlags(log.Ldate | log.Ltime | log.LUTC)
+	f := l.Fork("fork")
+	f.Log2Error("forked")
+	sink := &bytes.Buffer{}
+	l.SetSinks(&Sink{MinLevel: LoggerLevel0Debug, MaxLevel: LoggerLevelNormal, Writer: sink})
+	l.Log2Error("routed")
+	if buf.String() != "2019/01/02 04:04:05 [api:E]forked\n" || sink.String() != "2019/01/02 04:04:05 [api:E]routed\n" {
+		t.Fatal(buf.String(), sink.String())
+	}
+}
+
+// waitFor 等待后台goroutine完成压缩或删除
+func waitFor(t *testing.T, what string, ok func() bool) {
+	for i := 0; i < 500; i++ {
+		if ok() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatal("timeout waiting for", what)
+}
+
+func exists(f string) bool {
+	_, err := os.Stat(f)
+	return err == nil
+}
+
+// go test -run TestClockRotateMonth -v -count=1
+func TestClockRotateMonth(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(dir+"/app/2018", 0755)
+	ioutil.WriteFile(dir+"/app/2018/2018-11.zip", nil, 0644)
+	ioutil.WriteFile(dir+"/app/2018/2018-12.zip", nil, 0644)
+
+	c := clocktest.New(time.Date(2019, 1, 31, 23, 59, 0, 0, time.UTC))
+	w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: "api_", CompressMode: ModeMonth, CompressKeep: 2, Location: time.UTC, Clock: c})
+	w.Write([]byte("january\n"))
+
+	// 进入2月后切换日志文件，压缩1月的日志，删除2个月前的压缩文件
+	// 1月的日志文件一分钟后关闭，关闭后才开始压缩
+	c.BlockUntil(1)
+	c.Add(time.Minute)
+	c.BlockUntil(2)
+	w.Write([]byte("february\n"))
+	if bs, _ := ioutil.ReadFile(dir + "/app/2019/02/api_2019-02-01.log"); string(bs) != "february\n" {
+		t.Fatal(string(bs))
+	}
+	c.Add(time.Minute)
+	waitFor(t, "month archive", func() bool {
+		return exists(dir+"/app/2019/2019-01.zip") && !exists(dir+"/app/2019/01") && !exists(dir+"/app/2018/2018-12.zip")
+	})
+	if !exists(dir + "/app/2018/2018-11.zip") {
+		t.Fatal("removed too much")
+	}
+
+	// 2月中间不压缩
+	c.Add(24 * time.Hour)
+	c.BlockUntil(1)
+	if files, _ := filepath.Glob(dir + "/app/2019/*.zip"); len(files) != 1 {
+		t.Fatal(files)
+	}
+}
+
+// go test -run TestClockRotateDay -v -count=1
+func TestClockRotateDay(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(dir+"/2019/02", 0755)
+	ioutil.WriteFile(dir+"/2019/02/api_2019-02-08.zip", nil, 0644)
+	ioutil.WriteFile(dir+"/2019/02/api_2019-02-09.zip", nil, 0644)
+
+	c := clocktest.New(time.Date(2019, 2, 10, 23, 59, 0, 0, time.UTC))
+	w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Name: "api_", CompressMode: ModeDay, CompressCount: 1, CompressKeep: 1, Location: time.UTC, Clock: c})
+	w.Write([]byte("day 10\n"))
+
+	c.BlockUntil(1)
+	c.Add(time.Minute)
+	c.BlockUntil(2)
+	c.Add(time.Minute)
+	waitFor(t, "day archive", func() bool {
+		return exists(dir+"/2019/02/api_2019-02-10.zip") && !exists(dir+"/2019/02/api_2019-02-10.log") && !exists(dir+"/2019/02/api_2019-02-08.zip")
+	})
+	if !exists(dir + "/2019/02/api_2019-02-09.zip") {
+		t.Fatal("removed too much")
+	}
+}
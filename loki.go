@@ -0,0 +1,227 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ohko/logger/internal/snappy"
+	"github.com/ohko/logger/parser"
+)
+
+// LokiWriterOption ...
+type LokiWriterOption struct {
+	URL        string            // Loki地址，例如 http://127.0.0.1:3100
+	Protobuf   bool              // 使用snappy压缩的protobuf格式推送，默认JSON
+	Label      string            // 日志标签，与DefaultWriterOption.Label相同，作为stream的label标签
+	Labels     map[string]string // 其它stream标签，例如 job、host
+	TenantID   string            // 多租户时的X-Scope-OrgID
+	BatchSize  int               // 每批最多的日志条数，默认100
+	BatchWait  time.Duration     // 每批最长的等待时间，默认1秒
+	BufferSize int               // 等待发送的最多日志条数，超出后丢弃，默认10000
+	MaxRetries int               // 失败重试次数，默认3次
+	MinBackoff time.Duration     // 第一次重试的等待时间，默认500毫秒
+	MaxBackoff time.Duration     // 最长的重试等待时间，默认10秒
+	Timeout    time.Duration     // HTTP请求超时，默认10秒
+	OnError    func(error)       // 推送失败的回调
+}
+
+// LokiWriter 批量推送日志到Loki的/loki/api/v1/push接口
+// stream标签包含label、prefix、level以及Labels
+type LokiWriter struct {
+	option *LokiWriterOption
+	client *http.Client
+	batch  *batcher
+}
+
+// NewLokiWriter ...
+func NewLokiWriter(option *LokiWriterOption) *LokiWriter {
+	o := &LokiWriter{option: option}
+	if o.option == nil {
+		o.option = &LokiWriterOption{}
+	}
+	if o.option.URL == "" {
+		o.option.URL = "http://127.0.0.1:3100"
+	}
+	if o.option.BatchSize <= 0 {
+		o.option.BatchSize = 100
+	}
+	if o.option.BatchWait <= 0 {
+		o.option.BatchWait = time.Second
+	}
+	if o.option.BufferSize <= 0 {
+		o.option.BufferSize = 10000
+	}
+	if o.option.MaxRetries <= 0 {
+		o.option.MaxRetries = 3
+	}
+	if o.option.MinBackoff <= 0 {
+		o.option.MinBackoff = time.Millisecond * 500
+	}
+	if o.option.MaxBackoff <= 0 {
+		o.option.MaxBackoff = time.Second * 10
+	}
+	if o.option.Timeout <= 0 {
+		o.option.Timeout = time.Second * 10
+	}
+	o.client = &http.Client{Timeout: o.option.Timeout}
+	o.batch = newBatcher(o.option.BatchSize, o.option.BatchWait, o.option.BufferSize, o.push)
+	o.batch.onError = o.option.OnError
+	return o
+}
+
+// Write 每次Write是一条Logger日志
+func (o *LokiWriter) Write(p []byte) (n int, err error) {
+	if err := o.batch.add(newSinkEntry(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close 推送剩余的日志
+func (o *LokiWriter) Close() error {
+	o.batch.close()
+	return nil
+}
+
+type lokiStream struct {
+	labels  map[string]string
+	key     string
+	entries []*sinkEntry
+}
+
+// streams 按stream标签分组，保持日志顺序
+func (o *LokiWriter) streams(entries []*sinkEntry) []*lokiStream {
+	var streams []*lokiStream
+	index := map[string]*lokiStream{}
+	for _, e := range entries {
+		labels := map[string]string{}
+		for k, v := range o.option.Labels {
+			labels[k] = v
+		}
+		labels["level"] = parser.LevelName(e.Level)
+		if o.option.Label != "" {
+			labels["label"] = strings.TrimPrefix(o.option.Label, "/")
+		}
+		if e.Prefix != "" {
+			labels["prefix"] = e.Prefix
+		}
+		key := lokiLabels(labels)
+		s, ok := index[key]
+		if !ok {
+			s = &lokiStream{labels: labels, key: key}
+			index[key] = s
+			streams = append(streams, s)
+		}
+		s.entries = append(s.entries, e)
+	}
+	return streams
+}
+
+// lokiLabels 转换为 {a="1", b="2"} 格式
+func lokiLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, k+"="+strconv.Quote(labels[k]))
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+func (o *LokiWriter) push(entries []*sinkEntry) error {
+	streams := o.streams(entries)
+	var body []byte
+	contentType := "application/json"
+	if o.option.Protobuf {
+		body = snappy.Encode(lokiProtobuf(streams))
+		contentType = "application/x-protobuf"
+	} else {
+		body = lokiJSON(streams)
+	}
+
+	url := strings.TrimSuffix(o.option.URL, "/") + "/loki/api/v1/push"
+	return retry(retryOption{o.option.MaxRetries, o.option.MinBackoff, o.option.MaxBackoff}, func() (bool, error) {
+		req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+		if err != nil {
+			return false, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		if o.option.TenantID != "" {
+			req.Header.Set("X-Scope-OrgID", o.option.TenantID)
+		}
+		res, retryable, err := httpDo(o.client, req)
+		if err != nil {
+			return retryable, err
+		}
+		res.Body.Close()
+		return false, nil
+	})
+}
+
+func lokiJSON(streams []*lokiStream) []byte {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	v := struct {
+		Streams []stream `json:"streams"`
+	}{}
+	for _, s := range streams {
+		st := stream{Stream: s.labels}
+		for _, e := range s.entries {
+			st.Values = append(st.Values, [2]string{strconv.FormatInt(e.Time.UnixNano(), 10), e.line()})
+		}
+		v.Streams = append(v.Streams, st)
+	}
+	bs, _ := json.Marshal(&v)
+	return bs
+}
+
+// lokiProtobuf 编码logproto.PushRequest
+//
+//	message PushRequest { repeated StreamAdapter streams = 1; }
+//	message StreamAdapter { string labels = 1; repeated EntryAdapter entries = 2; }
+//	message EntryAdapter { google.protobuf.Timestamp timestamp = 1; string line = 2; }
+func lokiProtobuf(streams []*lokiStream) []byte {
+	var req []byte
+	for _, s := range streams {
+		var stream []byte
+		stream = pbBytes(stream, 1, []byte(s.key))
+		for _, e := range s.entries {
+			var ts, entry []byte
+			ts = pbVarint(ts, 1, uint64(e.Time.Unix()))
+			ts = pbVarint(ts, 2, uint64(e.Time.Nanosecond()))
+			entry = pbBytes(entry, 1, ts)
+			entry = pbBytes(entry, 2, []byte(e.line()))
+			stream = pbBytes(stream, 2, entry)
+		}
+		req = pbBytes(req, 1, stream)
+	}
+	return req
+}
+
+func pbVarint(b []byte, field int, v uint64) []byte {
+	b = appendUvarint(b, uint64(field<<3))
+	return appendUvarint(b, v)
+}
+
+func pbBytes(b []byte, field int, v []byte) []byte {
+	b = appendUvarint(b, uint64(field<<3|2))
+	b = appendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+func appendUvarint(b []byte, v uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	return append(b, buf[:n]...)
+}
@@ -0,0 +1,96 @@
+package logger
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ohko/logger/internal/snappy"
+)
+
+// go test -run TestLoki -v -count=1
+func TestLokiJSON(t *testing.T) {
+	var lock sync.Mutex
+	var bodies [][]byte
+	calls := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		calls++
+		// 第一次返回500，测试重试
+		if calls == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		if r.URL.Path != "/loki/api/v1/push" || r.Header.Get("X-Scope-OrgID") != "tenant" {
+			t.Error(r.URL.Path, r.Header)
+		}
+		bs, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, bs)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer ts.Close()
+
+	w := NewLokiWriter(&LokiWriterOption{URL: ts.URL, Label: "lable", Labels: map[string]string{"job": "test"}, TenantID: "tenant",
+		BatchSize: 3, BatchWait: time.Hour, MinBackoff: time.Millisecond})
+	l := NewLogger(w)
+	l.SetPrefix("api")
+	l.Log0Debug("debug")
+	l.Log2Error("error")
+	l.Fork("db").Log2Error("db error")
+	w.Close()
+
+	if len(bodies) != 1 {
+		t.Fatal(calls, len(bodies))
+	}
+	var req struct {
+		Streams []struct {
+			Stream map[string]string
+			Values [][2]string
+		}
+	}
+	if err := json.Unmarshal(bodies[0], &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Streams) != 2 {
+		t.Fatal(string(bodies[0]))
+	}
+	s := req.Streams[1]
+	if s.Stream["level"] != "error" || s.Stream["prefix"] != "api" || s.Stream["label"] != "lable" || s.Stream["job"] != "test" || len(s.Values) != 2 {
+		t.Fatal(string(bodies[0]))
+	}
+	if !strings.HasSuffix(s.Values[1][1], "[api:E]db error") {
+		t.Fatal(s.Values[1])
+	}
+}
+
+func TestLokiProtobuf(t *testing.T) {
+	body := make(chan []byte, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Error(r.Header)
+		}
+		bs, _ := ioutil.ReadAll(r.Body)
+		body <- bs
+	}))
+	defer ts.Close()
+
+	w := NewLokiWriter(&LokiWriterOption{URL: ts.URL, Protobuf: true, BatchWait: time.Millisecond * 10})
+	defer w.Close()
+	l := NewLogger(w)
+	l.SetPrefix("api")
+	l.Log1Warn("warning")
+
+	bs, err := snappy.Decode(<-body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bs), `{level="warning", prefix="api"}`) || !strings.Contains(string(bs), "[api:W]warning") {
+		t.Fatalf("%q", bs)
+	}
+}
@@ -5,13 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/mail"
 	"net/smtp"
 	"strings"
 	"time"
 
+	"github.com/ohko/logger/clock"
 	"github.com/ohko/logger/email"
 )
 
@@ -22,6 +22,8 @@ type MonitorOption struct {
 	MaxSize        int64         // 日志目录最大磁盘占用字节数
 	NotifyRate     time.Duration // 通知频率
 	CustomCallback func() error  // 达到最大占用数量时，回调通知函数
+	ErrorHandler   ErrorHandler  // 通知失败的回调，默认输出到os.Stderr
+	Clock          clock.Clock   // 时间来源，默认clock.Real，测试时使用clocktest.Clock
 
 	// 钉钉webhook通知
 	DingDing string // webook地址
@@ -42,6 +44,9 @@ type Monitor struct {
 // NewMonitor ...
 func NewMonitor(option *MonitorOption) *Monitor {
 	o := &Monitor{option: option}
+	if o.option.Clock == nil {
+		o.option.Clock = clock.Real
+	}
 	go o.monitor()
 	return o
 }
@@ -54,13 +59,17 @@ func (o *Monitor) monitor() {
 	for {
 		size := o.GetSize(o.option.LogPath)
 		if size > o.option.MaxSize {
+			var err error
 			if o.option.CustomCallback != nil {
-				o.option.CustomCallback()
+				err = o.option.CustomCallback()
 			} else {
-				o.NotifyCallback(o.option.ID, size)
+				err = o.NotifyCallback(o.option.ID, size)
+			}
+			if err != nil {
+				handleError(o.option.ErrorHandler, ErrorKindNotify, o.option.LogPath, err)
 			}
 		}
-		time.Sleep(rate)
+		o.option.Clock.Sleep(rate)
 	}
 }
 
@@ -110,12 +119,15 @@ func (o *Monitor) dingdingCallback(id int, size int64) error {
 	if err != nil {
 		return err
 	}
-	log.Println("DingDing:", url, body)
 	req.Header.Set("Content-Type", "application/json")
-	_, err = client.Do(req)
+	res, err := client.Do(req)
 	if err != nil {
 		return err
 	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("dingding: %s", res.Status)
+	}
 
 	return nil
 }
@@ -1,20 +1,39 @@
 package logger
 
 import (
+	"errors"
+	"io/ioutil"
+	"os"
 	"testing"
 	"time"
+
+	"github.com/ohko/logger/clock/clocktest"
 )
 
 // go test -run TestNewMonitor -v -count=1
 func TestNewMonitor(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(dir+"/2019/01", 0755)
+	ioutil.WriteFile(dir+"/2019/01/2019-01-01.log", make([]byte, 100), 0644)
+
+	c := clocktest.New(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	calls := make(chan struct{}, 10)
+	var got []*LoggerError
 	o := NewMonitor(&MonitorOption{
-		ID:         123,               // 标识符
-		LogPath:    "./log",           // 要监控的日志目录
-		MaxSize:    100 * 1024 * 1024, // 100MB
-		NotifyRate: time.Minute,       // 监控频率
+		ID:         123,         // 标识符
+		LogPath:    dir,         // 要监控的日志目录
+		MaxSize:    50,          // 50B
+		NotifyRate: time.Minute, // 监控频率
+		Clock:      c,
+		CustomCallback: func() error {
+			calls <- struct{}{}
+			return errors.New("notify failed")
+		},
+		ErrorHandler: func(err *LoggerError) { got = append(got, err) },
 
 		// 钉钉Webhook通知
-		DingDing: "https://oapi.dingtalk.com/robot/send?access_token=xxxxx",
+		// DingDing: "https://oapi.dingtalk.com/robot/send?access_token=xxxxx",
 
 		// MailAddr: "smtp.exmail.qq.com:465",
 		// MailUser: "xxx@qq.com",
@@ -22,7 +41,22 @@ func TestNewMonitor(t *testing.T) {
 		// MailName: "XXX",
 		// ToAddr:   "to@qq.com",
 	})
-	t.Log(o.GetSize("./log"))
-	time.Sleep(time.Minute)
-	// o.NotifyCallback(1, 123*1024)
+	if size := o.GetSize(dir); size != 100 {
+		t.Fatal(size)
+	}
+
+	// 启动时检查一次，之后每NotifyRate检查一次
+	<-calls
+	c.BlockUntil(1)
+	if len(got) != 1 || got[0].Kind != ErrorKindNotify || got[0].Path != dir {
+		t.Fatal(got)
+	}
+	c.Add(30 * time.Second)
+	select {
+	case <-calls:
+		t.Fatal("notified before NotifyRate")
+	case <-time.After(10 * time.Millisecond):
+	}
+	c.Add(30 * time.Second)
+	<-calls
 }
@@ -0,0 +1,348 @@
+package logger
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// NetWriterOption ...
+type NetWriterOption struct {
+	Network    string        // 网络类型 [tcp|tls|unix]，默认tcp
+	Addr       string        // 日志收集服务器地址
+	TLSConfig  *tls.Config   // tls连接的配置
+	BufferSize int           // 内存中缓存的日志条数，超出后写入spool文件，默认1000
+	Path       string        // spool文件目录，默认目录：./log
+	Label      string        // 日志标签
+	Name       string        // spool文件名，默认net，文件为 Path/Label/Name.spool
+	Timeout    time.Duration // 连接和写超时，默认5秒
+	MaxDelay   time.Duration // 重连的最大间隔，默认1分钟
+}
+
+// NetWriter 把日志发送到网络日志收集服务器，Write不会阻塞
+// 连接断开时日志缓存在内存中，超出BufferSize后写入spool文件，重连后按顺序补发
+type NetWriter struct {
+	option *NetWriterOption
+	spool  string
+
+	lock     sync.Mutex
+	cond     *sync.Cond
+	mem      [][]byte
+	spooling bool     // spool文件中有未发送的日志，新日志也要写入spool保证顺序
+	spoolW   *os.File // spool写句柄
+	closed   bool
+	done     chan struct{}
+
+	conn  net.Conn
+	delay time.Duration
+}
+
+// NewNetWriter ...
+func NewNetWriter(option *NetWriterOption) *NetWriter {
+	o := &NetWriter{option: option, done: make(chan struct{})}
+	o.cond = sync.NewCond(&o.lock)
+	if o.option == nil {
+		o.option = &NetWriterOption{}
+	}
+	if o.option.Network == "" {
+		o.option.Network = "tcp"
+	}
+	if o.option.BufferSize <= 0 {
+		o.option.BufferSize = 1000
+	}
+	if o.option.Path == "" {
+		o.option.Path = "./log"
+	}
+	if o.option.Name == "" {
+		o.option.Name = "net"
+	}
+	if o.option.Timeout <= 0 {
+		o.option.Timeout = time.Second * 5
+	}
+	if o.option.MaxDelay <= 0 {
+		o.option.MaxDelay = time.Minute
+	}
+	o.spool = filepath.Join(o.option.Path, o.option.Label, o.option.Name+".spool")
+
+	// 上次退出时未发送的日志
+	if info, err := os.Stat(o.spool); err == nil && info.Size() > 0 {
+		o.spooling = true
+	}
+
+	go o.backend()
+	return o
+}
+
+// Write 日志放入发送队列
+func (o *NetWriter) Write(p []byte) (n int, err error) {
+	b := make([]byte, len(p))
+	copy(b, p)
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.closed {
+		return 0, os.ErrClosed
+	}
+	if !o.spooling && len(o.mem) < o.option.BufferSize {
+		o.mem = append(o.mem, b)
+		o.cond.Signal()
+		return len(p), nil
+	}
+
+	// 内存缓存已满，写入spool文件
+	if err := o.appendSpool(b); err != nil {
+		return 0, err
+	}
+	o.spooling = true
+	o.cond.Signal()
+	return len(p), nil
+}
+
+// appendSpool spool文件中每条日志为4字节长度+日志内容
+func (o *NetWriter) appendSpool(b []byte) error {
+	if o.spoolW == nil {
+		os.MkdirAll(filepath.Dir(o.spool), 0755)
+		f, err := os.OpenFile(o.spool, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		o.spoolW = f
+	}
+	buf := make([]byte, 4+len(b))
+	binary.BigEndian.PutUint32(buf, uint32(len(b)))
+	copy(buf[4:], b)
+	_, err := o.spoolW.Write(buf)
+	return err
+}
+
+// Close 停止发送，未发送的日志保存到spool文件，下次启动时补发
+func (o *NetWriter) Close() error {
+	o.lock.Lock()
+	if o.closed {
+		o.lock.Unlock()
+		return nil
+	}
+	o.closed = true
+	o.cond.Broadcast()
+	o.lock.Unlock()
+	<-o.done
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	var err error
+	if len(o.mem) > 0 {
+		// 内存中的日志在spool之前，需要重写spool文件
+		err = o.prependSpool(o.mem)
+		o.mem = nil
+	}
+	if o.spoolW != nil {
+		o.spoolW.Close()
+		o.spoolW = nil
+	}
+	if o.conn != nil {
+		o.conn.Close()
+		o.conn = nil
+	}
+	return err
+}
+
+func (o *NetWriter) prependSpool(mem [][]byte) error {
+	if o.spoolW != nil {
+		o.spoolW.Close()
+		o.spoolW = nil
+	}
+	old, _ := os.Open(o.spool)
+	tmp := o.spool + ".tmp"
+	os.MkdirAll(filepath.Dir(o.spool), 0755)
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	o.spoolW = f
+	for _, b := range mem {
+		if err := o.appendSpool(b); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if old != nil {
+		_, err = io.Copy(f, old)
+		old.Close()
+	}
+	o.spoolW = nil
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, o.spool)
+}
+
+func (o *NetWriter) backend() {
+	defer close(o.done)
+	var spoolR *bufio.Reader
+	var spoolF *os.File
+	defer func() {
+		if spoolF != nil {
+			spoolF.Close()
+		}
+	}()
+
+	for {
+		o.lock.Lock()
+		for !o.closed && len(o.mem) == 0 && !o.spooling {
+			o.cond.Wait()
+		}
+		if o.closed {
+			o.lock.Unlock()
+			if spoolF != nil {
+				// 已经发送的日志从spool文件中删除
+				o.rewriteSpool(spoolF, spoolR, nil)
+				spoolF = nil
+			}
+			return
+		}
+
+		// 内存中的日志先于spool文件中的日志
+		var b []byte
+		fromMem := len(o.mem) > 0
+		if fromMem {
+			b = o.mem[0]
+		}
+		o.lock.Unlock()
+
+		if !fromMem {
+			// spool文件的读写都在锁内，不会读到写了一半的日志
+			o.lock.Lock()
+			if spoolF == nil {
+				f, err := os.Open(o.spool)
+				if err != nil {
+					o.spooling = false
+					o.lock.Unlock()
+					continue
+				}
+				spoolF, spoolR = f, bufio.NewReader(f)
+			}
+			var err error
+			if b, err = readSpool(spoolR); err != nil {
+				// spool文件已经读完，删除后新的日志写入内存
+				spoolF.Close()
+				spoolF, spoolR = nil, nil
+				if o.spoolW != nil {
+					o.spoolW.Close()
+					o.spoolW = nil
+				}
+				os.Remove(o.spool)
+				o.spooling = false
+				o.lock.Unlock()
+				continue
+			}
+			o.lock.Unlock()
+		}
+
+		for !o.send(b) {
+			if !o.wait() {
+				if !fromMem && spoolF != nil {
+					// 关闭前未发送成功的spool日志保留在文件中
+					o.rewriteSpool(spoolF, spoolR, [][]byte{b})
+					spoolF = nil
+				}
+				return
+			}
+		}
+		if fromMem {
+			o.lock.Lock()
+			o.mem = o.mem[1:]
+			o.lock.Unlock()
+		}
+	}
+}
+
+func readSpool(r *bufio.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	b := make([]byte, binary.BigEndian.Uint32(size[:]))
+	_, err := io.ReadFull(r, b)
+	return b, err
+}
+
+// rewriteSpool 删除已经发送的spool日志，pending为已经读出但未发送的日志
+func (o *NetWriter) rewriteSpool(f *os.File, r *bufio.Reader, pending [][]byte) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	mem := pending
+	for {
+		b, err := readSpool(r)
+		if err != nil {
+			break
+		}
+		mem = append(mem, b)
+	}
+	f.Close()
+	if o.spoolW != nil {
+		o.spoolW.Close()
+		o.spoolW = nil
+	}
+	os.Remove(o.spool)
+	if len(mem) > 0 {
+		o.prependSpool(mem)
+	}
+}
+
+func (o *NetWriter) send(b []byte) bool {
+	if o.conn == nil {
+		var conn net.Conn
+		var err error
+		d := &net.Dialer{Timeout: o.option.Timeout}
+		if o.option.Network == "tls" {
+			conn, err = tls.DialWithDialer(d, "tcp", o.option.Addr, o.option.TLSConfig)
+		} else {
+			conn, err = d.Dial(o.option.Network, o.option.Addr)
+		}
+		if err != nil {
+			return false
+		}
+		o.conn = conn
+	}
+	o.conn.SetWriteDeadline(time.Now().Add(o.option.Timeout))
+	if _, err := o.conn.Write(b); err != nil {
+		o.conn.Close()
+		o.conn = nil
+		return false
+	}
+	o.delay = 0
+	return true
+}
+
+// wait 指数退避等待重连，返回false表示已关闭
+func (o *NetWriter) wait() bool {
+	if o.delay == 0 {
+		o.delay = time.Millisecond * 100
+	} else if o.delay *= 2; o.delay > o.option.MaxDelay {
+		o.delay = o.option.MaxDelay
+	}
+
+	t := time.AfterFunc(o.delay, func() {
+		o.lock.Lock()
+		o.cond.Broadcast()
+		o.lock.Unlock()
+	})
+	defer t.Stop()
+
+	deadline := time.Now().Add(o.delay)
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for !o.closed && time.Now().Before(deadline) {
+		o.cond.Wait()
+	}
+	return !o.closed
+}
@@ -0,0 +1,74 @@
+package logger
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"testing"
+	"time"
+)
+
+// go test -run TestNetWriter -v -count=1
+func TestNetWriter(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+
+	// 预留一个端口，收集服务器先不启动
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+
+	w := NewNetWriter(&NetWriterOption{Addr: addr, BufferSize: 3, Path: dir, Label: "lable", MaxDelay: time.Millisecond * 200})
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(w, "line %d\n", i)
+	}
+	if _, err := os.Stat(dir + "/lable/net.spool"); err != nil {
+		t.Fatal(err)
+	}
+
+	// 关闭后再打开，未发送的日志从spool文件中恢复
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	w = NewNetWriter(&NetWriterOption{Addr: addr, BufferSize: 3, Path: dir, Label: "lable", MaxDelay: time.Millisecond * 200})
+	defer w.Close()
+	for i := 10; i < 15; i++ {
+		fmt.Fprintf(w, "line %d\n", i)
+	}
+
+	ln, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(time.Second * 5))
+	r := bufio.NewReader(conn)
+	for i := 0; i < 15; i++ {
+		s, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s != fmt.Sprintf("line %d\n", i) {
+			t.Fatal(i, s)
+		}
+	}
+
+	// spool补发完成后删除
+	fmt.Fprintf(w, "line %d\n", 15)
+	if s, _ := r.ReadString('\n'); s != "line 15\n" {
+		t.Fatal(s)
+	}
+	if _, err := os.Stat(dir + "/lable/net.spool"); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,211 @@
+// Package parser 解析Logger输出的文本日志格式
+//
+//	2006/01/02 15:04:05 /path/file.go:23: [prefix:D]message
+//
+// 支持SetFlags的各种组合、SetColor(true)输出的颜色代码以及包含换行的多行日志。
+package parser
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 日志等级，与logger.LoggerLevel*一致
+const (
+	LevelDebug   = 0 // [prefix:D]
+	LevelWarning = 1 // [prefix:W]
+	LevelError   = 2 // [prefix:E]
+	LevelFatal   = 3 // [prefix:F]
+	LevelTrace   = 4 // [prefix:T]
+	LevelNormal  = 6 // [prefix:N] 或者没有标签
+)
+
+// 审计日志模式(logger.DefaultWriterOption.Audit)每个文件第一行的链头和每条日志末尾的哈希，不属于日志内容
+//
+//	# logger audit chain prev=<64位十六进制>
+//	2019/02/02 10:00:01 [api:W]message chain=<64位十六进制>
+const (
+	AuditMarker = "# logger audit chain prev="
+	AuditSuffix = " chain="
+)
+
+// ErrFormat 不是Logger输出的日志格式
+var ErrFormat = errors.New("parser: not a log entry")
+
+// Entry 解析后的日志
+type Entry struct {
+	Time    time.Time `json:"time"`             // 日志时间，没有日期和时间时为零值
+	Caller  string    `json:"caller,omitempty"` // 调用者文件，Llongfile/Lshortfile，路径中不能有空格
+	Line    int       `json:"line,omitempty"`   // 调用者行号
+	Prefix  string    `json:"prefix"`           // 日志前缀
+	Level   int       `json:"level"`            // 日志等级
+	Message string    `json:"message"`          // 日志内容，多行日志包含换行
+	Raw     string    `json:"-"`                // 日志原文
+}
+
+var (
+	colorTagRe = regexp.MustCompile("\033\\[[0-9;]*m(\\[[^\\[\\]]*:[DWEFTN]\\]) \033\\[m")
+	colorRe    = regexp.MustCompile("\033\\[[0-9;]*m")
+	headerRe   = regexp.MustCompile(`^(?:(\d{4}/\d{2}/\d{2}) )?(?:(\d{2}:\d{2}:\d{2}(?:\.\d{1,9})?) )?(?:([^\s\[\]]+):(\d+): )?(?:\[([^\[\]]*):([DWEFTN])\])?`)
+	auditRe    = regexp.MustCompile(AuditSuffix + `[0-9a-f]{64}$`)
+	startRe    = regexp.MustCompile(`^(?:\d{4}/\d{2}/\d{2} |\d{2}:\d{2}:\d{2}(?:\.\d{1,9})? |(?:[^\s\[\]]+:\d+: )?\[[^\[\]]*:[DWEFTN]\])`)
+)
+
+// StripColor 去掉SetColor(true)输出的颜色代码
+func StripColor(s string) string {
+	if !strings.Contains(s, "\033[") {
+		return s
+	}
+	s = colorTagRe.ReplaceAllString(s, "$1")
+	return colorRe.ReplaceAllString(s, "")
+}
+
+// IsAuditMarker 是否是审计日志文件第一行的链头
+func IsAuditMarker(line string) bool {
+	return strings.HasPrefix(line, AuditMarker)
+}
+
+// StripAudit 去掉审计日志末尾的哈希
+func StripAudit(s string) string {
+	if !strings.Contains(s, AuditSuffix) {
+		return s
+	}
+	return auditRe.ReplaceAllString(s, "")
+}
+
+// IsEntryStart 判断是否是一条新日志的开始，否则属于上一条日志
+func IsEntryStart(line string) bool {
+	return startRe.MatchString(StripColor(line))
+}
+
+// Parser 日志解析器
+type Parser struct {
+	Location *time.Location // 日志时间的时区，默认time.Local，LUTC时使用time.UTC
+	Date     time.Time      // 没有Ldate时使用的日期，例如从日志文件名获取的日期
+}
+
+// Parse 解析一条日志，text可以包含多行，审计日志末尾的哈希不包含在Message和Raw中
+func (p *Parser) Parse(text string) (*Entry, error) {
+	text = StripAudit(strings.TrimSuffix(text, "\n"))
+	plain := StripColor(text)
+	m := headerRe.FindStringSubmatchIndex(plain)
+	if m == nil || m[1] == 0 {
+		return nil, ErrFormat
+	}
+	sub := func(i int) string {
+		if m[2*i] < 0 {
+			return ""
+		}
+		return plain[m[2*i]:m[2*i+1]]
+	}
+
+	e := &Entry{Level: LevelNormal, Message: plain[m[1]:], Raw: text}
+	loc := p.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	date, clock := sub(1), sub(2)
+	switch {
+	case date != "" && clock != "":
+		e.Time, _ = time.ParseInLocation("2006/01/02 15:04:05", date+" "+clock, loc)
+	case date != "":
+		e.Time, _ = time.ParseInLocation("2006/01/02", date, loc)
+	case clock != "" && !p.Date.IsZero():
+		e.Time, _ = time.ParseInLocation("2006/01/02 15:04:05", p.Date.Format("2006/01/02")+" "+clock, loc)
+	}
+	if file := sub(3); file != "" {
+		e.Caller = file
+		e.Line, _ = strconv.Atoi(sub(4))
+	}
+	if level := sub(6); level != "" {
+		e.Prefix = sub(5)
+		if i := strings.Index("DWEFT", level); i >= 0 {
+			e.Level = i
+		}
+	}
+	return e, nil
+}
+
+// ParseLine 使用本地时区解析一条日志
+func ParseLine(text string) (*Entry, error) {
+	return (&Parser{}).Parse(text)
+}
+
+// Reader 从io.Reader中逐条读取日志
+type Reader struct {
+	Parser
+
+	s    *bufio.Scanner
+	next string
+	err  error
+}
+
+// NewReader ...
+func NewReader(r io.Reader) *Reader {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &Reader{s: s}
+}
+
+// Next 返回下一条日志，读取完毕时返回io.EOF
+// 文件开头不属于任何日志的行作为一条LevelNormal日志返回，跳过审计日志的链头
+func (r *Reader) Next() (*Entry, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	lines := []string{}
+	if r.next != "" {
+		lines = append(lines, r.next)
+		r.next = ""
+	}
+	for r.s.Scan() {
+		line := r.s.Text()
+		if IsAuditMarker(line) {
+			continue
+		}
+		if len(lines) > 0 && IsEntryStart(line) {
+			r.next = line
+			break
+		}
+		lines = append(lines, line)
+	}
+	if r.next == "" {
+		if r.err = r.s.Err(); r.err == nil {
+			r.err = io.EOF
+		}
+		if len(lines) == 0 {
+			return nil, r.err
+		}
+	}
+
+	text := StripAudit(strings.Join(lines, "\n"))
+	e, err := r.Parse(text)
+	if err == ErrFormat {
+		plain := StripColor(text)
+		return &Entry{Level: LevelNormal, Message: plain, Raw: text}, nil
+	}
+	return e, err
+}
+
+// LevelName 返回日志等级的名称
+func LevelName(level int) string {
+	switch level {
+	case LevelDebug:
+		return "debug"
+	case LevelWarning:
+		return "warning"
+	case LevelError:
+		return "error"
+	case LevelFatal:
+		return "fatal"
+	case LevelTrace:
+		return "trace"
+	}
+	return "normal"
+}
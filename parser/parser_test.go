@@ -0,0 +1,126 @@
+package parser_test
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ohko/logger"
+	"github.com/ohko/logger/parser"
+)
+
+// go test github.com/ohko/logger/parser -v -count=1
+func TestParseLine(t *testing.T) {
+	e, err := parser.ParseLine("2019/02/02 10:00:01.123456 /src/a.go:12: [api:E]boom\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.Time.Equal(time.Date(2019, 2, 2, 10, 0, 1, 123456000, time.Local)) || e.Caller != "/src/a.go" || e.Line != 12 ||
+		e.Prefix != "api" || e.Level != parser.LevelError || e.Message != "boom" {
+		t.Fatalf("%+v", e)
+	}
+
+	e, _ = parser.ParseLine("C:/src/a.go:7: \033[31;1;7m[:F] \033[mfatal")
+	if e.Caller != "C:/src/a.go" || e.Line != 7 || e.Level != parser.LevelFatal || e.Message != "fatal" {
+		t.Fatalf("%+v", e)
+	}
+
+	p := &parser.Parser{Location: time.UTC, Date: time.Date(2019, 2, 2, 0, 0, 0, 0, time.UTC)}
+	e, _ = p.Parse("10:00:01 [x:N]normal")
+	if !e.Time.Equal(time.Date(2019, 2, 2, 10, 0, 1, 0, time.UTC)) || e.Level != parser.LevelNormal {
+		t.Fatalf("%+v", e)
+	}
+
+	// LstdFlags没有调用者文件时，日志内容中的host:port不是调用者
+	e, _ = parser.ParseLine("2019/02/02 10:00:00 [api:E]dial tcp 127.0.0.1:8080: refused")
+	if e.Caller != "" || e.Line != 0 || e.Prefix != "api" || e.Level != parser.LevelError || e.Message != "dial tcp 127.0.0.1:8080: refused" {
+		t.Fatalf("%+v", e)
+	}
+	e, _ = parser.ParseLine("2019/02/02 10:00:00 dial tcp 127.0.0.1:8080: refused")
+	if e.Caller != "" || e.Line != 0 || e.Level != parser.LevelNormal || e.Message != "dial tcp 127.0.0.1:8080: refused" {
+		t.Fatalf("%+v", e)
+	}
+
+	if _, err := parser.ParseLine("continued line"); err != parser.ErrFormat {
+		t.Fatal(err)
+	}
+}
+
+func TestReader(t *testing.T) {
+	flags := []int{
+		log.Ldate | log.Ltime | log.Llongfile,
+		log.Ldate | log.Ltime | log.Lmicroseconds | log.Lshortfile,
+		log.Ltime,
+		log.Lshortfile,
+		0,
+	}
+	for _, flag := range flags {
+		for _, color := range []bool{false, true} {
+			buf := bytes.NewBuffer(nil)
+			l := logger.NewLogger(buf)
+			l.SetFlags(flag)
+			l.SetColor(color)
+			l.SetPrefix("api")
+			l.Log1Warn("first")
+			l.Log2Error("multi\nline", "message")
+			l.Log4Trace("last")
+
+			r := parser.NewReader(buf)
+			var es []*parser.Entry
+			for {
+				e, err := r.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				es = append(es, e)
+			}
+			if len(es) != 3 {
+				t.Fatal(flag, color, len(es))
+			}
+			if es[1].Level != parser.LevelError || es[1].Prefix != "api" || es[1].Message != "multi\nline message" {
+				t.Fatalf("%d %v %+v", flag, color, es[1])
+			}
+			if es[2].Level != parser.LevelTrace || es[2].Message != "last" {
+				t.Fatalf("%d %v %+v", flag, color, es[2])
+			}
+			if flag&(log.Llongfile|log.Lshortfile) != 0 && !strings.HasSuffix(es[0].Caller, "parser_test.go") {
+				t.Fatalf("%d %v %+v", flag, color, es[0])
+			}
+			if flag&log.Ldate != 0 && time.Since(es[0].Time) > time.Minute {
+				t.Fatalf("%d %v %+v", flag, color, es[0])
+			}
+		}
+	}
+}
+
+func TestReaderAudit(t *testing.T) {
+	sum := strings.Repeat("ab", 32)
+	text := parser.AuditMarker + strings.Repeat("0", 64) + "\n" +
+		"2019/02/02 10:00:01 [api:W]first" + parser.AuditSuffix + sum + "\n" +
+		"2019/02/02 10:00:02 [api:E]multi\nline" + parser.AuditSuffix + sum + "\n"
+	r := parser.NewReader(strings.NewReader(text))
+	var es []*parser.Entry
+	for {
+		e, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		es = append(es, e)
+	}
+	if len(es) != 2 || es[0].Message != "first" || es[1].Message != "multi\nline" || strings.Contains(es[1].Raw, parser.AuditSuffix) {
+		t.Fatal(es)
+	}
+	// 不是64位十六进制时保留
+	if e, _ := parser.ParseLine("[api:W]a chain=xyz"); e.Message != "a chain=xyz" {
+		t.Fatal(e.Message)
+	}
+}
@@ -0,0 +1,391 @@
+package logger
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ohko/logger/parser"
+)
+
+// QueryOption 日志查询条件，零值表示不限制
+type QueryOption struct {
+	Start  time.Time      // 开始时间(包含)
+	End    time.Time      // 结束时间(不包含)
+	Levels []int          // 日志等级，LoggerLevel0Debug...LoggerLevelNormal
+	Prefix string         // 日志前缀
+	Text   string         // 包含的文本
+	Regexp *regexp.Regexp // 匹配的正则表达式
+	Limit  int            // 最多返回的条数
+
+	Location *time.Location // 日志文件名中日期的时区，与DefaultWriterOption.Location相同，默认time.Local
+	OnError  func(error)    // 无法读取的文件(例如没有密钥的加密压缩文件)跳过后的回调，参数为*QueryError，为nil时Query最后返回第一个错误
+}
+
+// QueryError 查询时跳过的无法读取的文件
+type QueryError struct {
+	File string // 相对日志目录的文件路径
+	Err  error
+}
+
+func (e *QueryError) Error() string {
+	return "query " + e.File + ": " + e.Err.Error()
+}
+
+// location 日志文件名中日期的时区
+func (q *QueryOption) location() *time.Location {
+	if q.Location == nil {
+		return time.Local
+	}
+	return q.Location
+}
+
+// QueryLine 查询结果
+type QueryLine struct {
+	File    string    `json:"file"`             // 相对日志目录的文件路径
+	Entry   string    `json:"entry,omitempty"`  // zip压缩包内的文件
+	Time    time.Time `json:"time"`             // 日志时间
+	Caller  string    `json:"caller,omitempty"` // 调用者文件
+	Line    int       `json:"line,omitempty"`   // 调用者行号
+	Level   int       `json:"level"`            // 日志等级
+	Prefix  string    `json:"prefix"`           // 日志前缀
+	Message string    `json:"message"`          // 日志内容
+	Text    string    `json:"text"`             // 日志原文，多行日志包含换行
+}
+
+// NewQueryLine 使用解析后的日志生成查询结果
+func NewQueryLine(file, entry string, e *parser.Entry) *QueryLine {
+	return &QueryLine{
+		File:    file,
+		Entry:   entry,
+		Time:    e.Time,
+		Caller:  e.Caller,
+		Line:    e.Line,
+		Level:   e.Level,
+		Prefix:  e.Prefix,
+		Message: e.Message,
+		Text:    e.Raw,
+	}
+}
+
+// errQueryLimit 达到查询数量后停止查询
+var errQueryLimit = errors.New("query limit")
+
+var (
+	dayRe       = regexp.MustCompile(`\d{4}-\d{2}-\d{2}`)
+	fileMonthRe = regexp.MustCompile(`(\d{4}-\d{2})\.zip(\.enc)?$`)
+)
+
+// fileDay 日志文件或压缩包路径中最后的2006-01-02，例如 name_2006-01-02.log 或 2006-01-02/name.0.log
+func fileDay(rel string) string {
+	if !strings.HasSuffix(rel, ".log") && !isArchive(rel) {
+		return ""
+	}
+	days := dayRe.FindAllString(rel, -1)
+	if len(days) == 0 {
+		return ""
+	}
+	return days[len(days)-1]
+}
+
+// Query 按条件查询日志目录下的日志文件和压缩包，结果按时间顺序回调fn
+// fn返回错误时停止查询，无法读取的文件跳过后回调QueryOption.OnError，继续查询其它文件
+// 按默认模板的/2006/01/目录和路径中的2006-01-02跳过时间范围外的文件，并作为没有Ldate的日志的日期，
+// Template使用其它时间格式(例如{20060102})时不能跳过文件，没有Ldate的日志也没有时间，按Start或End查询时不返回
+func Query(root string, q *QueryOption, fn func(*QueryLine) error) error {
+	if q == nil {
+		q = &QueryOption{}
+	}
+
+	type candidate struct {
+		file  string
+		start time.Time
+	}
+	var files []candidate
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		start, end, ok := logFileRange(rel, info.IsDir(), q.location())
+		if ok && !q.overlap(start, end) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// 跳过current.log等符号链接，避免重复查询
+		if info.IsDir() || info.Mode()&os.ModeSymlink != 0 || !(strings.HasSuffix(rel, ".log") || isArchive(rel)) {
+			return nil
+		}
+		files = append(files, candidate{file: rel, start: start})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		if !files[i].start.Equal(files[j].start) {
+			return files[i].start.Before(files[j].start)
+		}
+		return files[i].file < files[j].file
+	})
+
+	count := 0
+	var skipped error
+	for _, f := range files {
+		var stop error
+		err := QueryFile(root, f.file, q, func(l *QueryLine) error {
+			if stop = fn(l); stop != nil {
+				return stop
+			}
+			count++
+			if q.Limit > 0 && count >= q.Limit {
+				stop = errQueryLimit
+			}
+			return stop
+		})
+		if err == errQueryLimit {
+			return nil
+		}
+		if err != nil && err == stop {
+			return err
+		}
+		if err != nil {
+			e := &QueryError{File: f.file, Err: err}
+			if q.OnError != nil {
+				q.OnError(e)
+			} else if skipped == nil {
+				skipped = e
+			}
+		}
+	}
+	return skipped
+}
+
+// logFileRange 根据日志目录结构 /2006/01/name_2006-01-02.log 推算文件或目录包含的时间范围，loc为文件名中日期的时区
+// 也识别Template中{2006-01-02}格式的目录和文件名，其它时间格式无法推算
+func logFileRange(rel string, dir bool, loc *time.Location) (time.Time, time.Time, bool) {
+	if dir {
+		parts := strings.Split(rel, "/")
+		n := len(parts)
+		if n >= 1 && len(parts[n-1]) == len("2006-01-02") {
+			if t, err := time.ParseInLocation("2006-01-02", parts[n-1], loc); err == nil {
+				return t, t.AddDate(0, 0, 1), true
+			}
+		}
+		if n >= 2 && isDigits(parts[n-2], 4) && isDigits(parts[n-1], 2) {
+			if t, err := time.ParseInLocation("2006/01", parts[n-2]+"/"+parts[n-1], loc); err == nil {
+				return t, t.AddDate(0, 1, 0), true
+			}
+		}
+		if n >= 1 && isDigits(parts[n-1], 4) {
+			if t, err := time.ParseInLocation("2006", parts[n-1], loc); err == nil {
+				return t, t.AddDate(1, 0, 0), true
+			}
+		}
+		return time.Time{}, time.Time{}, false
+	}
+	if day := fileDay(rel); day != "" {
+		if t, err := time.ParseInLocation("2006-01-02", day, loc); err == nil {
+			return t, t.AddDate(0, 0, 1), true
+		}
+	}
+	if m := fileMonthRe.FindStringSubmatch(rel); m != nil {
+		if t, err := time.ParseInLocation("2006-01", m[1], loc); err == nil {
+			return t, t.AddDate(0, 1, 0), true
+		}
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+func isDigits(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func (q *QueryOption) overlap(start, end time.Time) bool {
+	if !q.Start.IsZero() && !end.After(q.Start) {
+		return false
+	}
+	if !q.End.IsZero() && !start.Before(q.End) {
+		return false
+	}
+	return true
+}
+
+// Match 判断日志是否符合查询条件，设置了Start或End时不返回没有时间的日志
+func (q *QueryOption) Match(l *QueryLine) bool {
+	if (!q.Start.IsZero() || !q.End.IsZero()) && (l.Time.IsZero() || !q.overlap(l.Time, l.Time.Add(1))) {
+		return false
+	}
+	if len(q.Levels) > 0 {
+		ok := false
+		for _, level := range q.Levels {
+			if level == l.Level {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	if q.Prefix != "" && q.Prefix != l.Prefix {
+		return false
+	}
+	if q.Text != "" && !strings.Contains(l.Text, q.Text) {
+		return false
+	}
+	if q.Regexp != nil && !q.Regexp.MatchString(l.Text) {
+		return false
+	}
+	return true
+}
+
+// QueryFile 查询单个日志文件，zip压缩包会查询其中所有的文件
+func QueryFile(root, file string, q *QueryOption, fn func(*QueryLine) error) error {
+	if q == nil {
+		q = &QueryOption{}
+	}
+	entries := []string{""}
+	if isArchive(file) {
+		var err error
+		if entries, err = zipEntries(root, file); err != nil {
+			return err
+		}
+		sort.Strings(entries)
+	}
+
+	for _, entry := range entries {
+		rc, err := OpenLogFile(root, file, entry)
+		if err != nil {
+			return err
+		}
+
+		// 没有Ldate的日志使用文件名中的日期
+		r := parser.NewReader(rc)
+		if entry != "" {
+			r.Date, _, _ = logFileRange(entry, false, q.location())
+		} else {
+			r.Date, _, _ = logFileRange(file, false, q.location())
+		}
+		for {
+			var e *parser.Entry
+			if e, err = r.Next(); err != nil {
+				break
+			}
+			l := NewQueryLine(file, entry, e)
+			if !q.Match(l) {
+				continue
+			}
+			if err = fn(l); err != nil {
+				break
+			}
+		}
+		rc.Close()
+		if err != io.EOF {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseQueryOption 从HTTP参数解析查询条件
+// start/end: 2006-01-02 或 2006-01-02 15:04:05 或 RFC3339
+// level: 逗号分隔的日志等级，例如 1,2,3
+func ParseQueryOption(r *http.Request) (*QueryOption, error) {
+	q := &QueryOption{Prefix: r.FormValue("prefix"), Text: r.FormValue("text")}
+	var err error
+	if q.Start, err = parseQueryTime(r.FormValue("start")); err != nil {
+		return nil, err
+	}
+	if q.End, err = parseQueryTime(r.FormValue("end")); err != nil {
+		return nil, err
+	}
+	if s := r.FormValue("level"); s != "" {
+		for _, v := range strings.Split(s, ",") {
+			level, err := strconv.Atoi(strings.TrimSpace(v))
+			if err != nil {
+				return nil, err
+			}
+			q.Levels = append(q.Levels, level)
+		}
+	}
+	if s := r.FormValue("regexp"); s != "" {
+		if q.Regexp, err = regexp.Compile(s); err != nil {
+			return nil, err
+		}
+	}
+	if s := r.FormValue("limit"); s != "" {
+		if q.Limit, err = strconv.Atoi(s); err != nil {
+			return nil, err
+		}
+	}
+	return q, nil
+}
+
+func parseQueryTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05", "2006-01-02T15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// handleQuery 注册日志查询接口，默认返回JSON lines，format=text返回日志原文
+// loc为日志文件名中日期的时区，跳过的文件回调onError
+func handleQuery(ms *http.ServeMux, root string, loc *time.Location, onError func(error)) {
+	ms.HandleFunc("/logs/query", func(w http.ResponseWriter, r *http.Request) {
+		q, err := ParseQueryOption(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		q.Location, q.OnError = loc, onError
+
+		text := r.FormValue("format") == "text"
+		if text {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+		}
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		Query(root, q, func(l *QueryLine) error {
+			var err error
+			if text {
+				_, err = io.WriteString(w, l.Text+"\n")
+			} else {
+				err = enc.Encode(l)
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return err
+		})
+	})
+}
@@ -0,0 +1,184 @@
+package logger
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// go test -run TestQuery -v -count=1
+func TestQuery(t *testing.T) {
+	root, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(root)
+	os.MkdirAll(filepath.Join(root, "2019/02"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "2019/02/name_2019-02-02.log"), []byte(
+		"2019/02/02 10:00:00 /src/a.go:10: [api:D]debug\n"+
+			"2019/02/02 11:00:00 /src/a.go:11: [api:E]error line1\nline2\n"+
+			"2019/02/02 12:00:00 /src/a.go:12: [db:E]db error\n"), 0644)
+	fz, _ := os.Create(filepath.Join(root, "2019/2019-01.zip"))
+	zw := zip.NewWriter(fz)
+	fw, _ := zw.Create("name_2019-01-31.log")
+	fw.Write([]byte("2019/01/31 23:00:00 /src/a.go:10: \033[31m[api:E] \033[merror in zip\n"))
+	zw.Close()
+	fz.Close()
+
+	query := func(q *QueryOption) []*QueryLine {
+		var ls []*QueryLine
+		if err := Query(root, q, func(l *QueryLine) error {
+			ls = append(ls, l)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		return ls
+	}
+
+	ls := query(&QueryOption{Levels: []int{LoggerLevel2Error}})
+	if len(ls) != 3 || ls[0].Entry != "name_2019-01-31.log" || ls[1].Text != "2019/02/02 11:00:00 /src/a.go:11: [api:E]error line1\nline2" {
+		t.Fatal(ls)
+	}
+
+	if ls[1].Caller != "/src/a.go" || ls[1].Line != 11 || ls[1].Message != "error line1\nline2" {
+		t.Fatal(ls[1])
+	}
+
+	start := time.Date(2019, 2, 2, 10, 30, 0, 0, time.Local)
+	ls = query(&QueryOption{Start: start, Prefix: "api"})
+	if len(ls) != 1 || ls[0].Level != LoggerLevel2Error {
+		t.Fatal(ls)
+	}
+
+	ls = query(&QueryOption{Regexp: regexp.MustCompile(`error (in|line)`), Limit: 1})
+	if len(ls) != 1 || ls[0].File != "2019/2019-01.zip" {
+		t.Fatal(ls)
+	}
+
+	if ls := query(&QueryOption{End: time.Date(2019, 1, 1, 0, 0, 0, 0, time.Local)}); len(ls) != 0 {
+		t.Fatal(ls)
+	}
+
+	// 按时间查询时不返回没有时间的日志
+	ioutil.WriteFile(filepath.Join(root, "undated.log"), []byte("[api:E]undated\n"), 0644)
+	if ls := query(&QueryOption{Start: start, Text: "undated"}); len(ls) != 0 {
+		t.Fatal(ls)
+	}
+	if ls := query(&QueryOption{Text: "undated"}); len(ls) != 1 {
+		t.Fatal(ls)
+	}
+	os.Remove(filepath.Join(root, "undated.log"))
+
+	ms := http.NewServeMux()
+	handleQuery(ms, root, time.Local, nil)
+	ts := httptest.NewServer(ms)
+	defer ts.Close()
+	res, err := http.Get(ts.URL + "/logs/query?format=text&level=0&start=2019-02-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if strings.TrimSpace(string(bs)) != "2019/02/02 10:00:00 /src/a.go:10: [api:D]debug" {
+		t.Fatal(string(bs))
+	}
+}
+
+// go test -run TestQuerySkip -v -count=1
+func TestQuerySkip(t *testing.T) {
+	root, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(root)
+	os.MkdirAll(filepath.Join(root, "2019/02"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "2019/2019-01.zip.enc"), []byte("no key"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "2019/02/name_2019-02-02.log"), []byte("2019/02/02 10:00:00 [api:W]readable\n"), 0644)
+
+	// 无法读取的压缩文件跳过，继续查询其它文件
+	var lines []string
+	var errs []error
+	q := &QueryOption{OnError: func(err error) { errs = append(errs, err) }}
+	if err := Query(root, q, func(l *QueryLine) error {
+		lines = append(lines, l.Message)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || len(errs) != 1 || errs[0].(*QueryError).File != "2019/2019-01.zip.enc" {
+		t.Fatal(lines, errs)
+	}
+
+	// 没有OnError时最后返回第一个错误
+	lines = nil
+	err := Query(root, nil, func(l *QueryLine) error {
+		lines = append(lines, l.Message)
+		return nil
+	})
+	if e, ok := err.(*QueryError); !ok || e.File != "2019/2019-01.zip.enc" || len(lines) != 1 {
+		t.Fatal(err, lines)
+	}
+}
+
+// go test -run TestQueryLocation -v -count=1
+func TestQueryLocation(t *testing.T) {
+	root, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(root)
+	os.MkdirAll(filepath.Join(root, "2019/02"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "2019/02/name_2019-02-02.log"), []byte("2019/01/31 12:00:00 [api:W]only pruned by file name\n"), 0644)
+
+	// 文件名中的日期使用DefaultWriterOption.Location的时区
+	end := time.Date(2019, 2, 1, 23, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		loc  *time.Location
+		want int
+	}{
+		{time.UTC, 0},
+		{time.FixedZone("+14", 14*3600), 1},
+	} {
+		n := 0
+		Query(root, &QueryOption{End: end, Location: c.loc}, func(l *QueryLine) error {
+			n++
+			return nil
+		})
+		if n != c.want {
+			t.Fatal(c.loc, n)
+		}
+	}
+}
+
+// go test -run TestQueryTemplate -v -count=1
+func TestQueryTemplate(t *testing.T) {
+	root, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(root)
+
+	// {host}/{2006-01-02}/{name}.{seq}.log 使用目录中的日期
+	for _, f := range []string{"host/2019-02-02/api.0.log", "host/2019-01-05/api.0.log"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(root, f)), 0755)
+		ioutil.WriteFile(filepath.Join(root, f), []byte("10:00:00 [api:W]"+f+"\n"), 0644)
+	}
+	for _, c := range []struct {
+		rel   string
+		dir   bool
+		start time.Time
+	}{
+		{"host/2019-02-02", true, time.Date(2019, 2, 2, 0, 0, 0, 0, time.UTC)},
+		{"host/2019-02-02/api.0.log", false, time.Date(2019, 2, 2, 0, 0, 0, 0, time.UTC)},
+		{"app/name.2019-02-03.1.log", false, time.Date(2019, 2, 3, 0, 0, 0, 0, time.UTC)},
+	} {
+		if start, _, ok := logFileRange(c.rel, c.dir, time.UTC); !ok || !start.Equal(c.start) {
+			t.Fatal(c.rel, start, ok)
+		}
+	}
+
+	var ls []*QueryLine
+	Query(root, &QueryOption{Start: time.Date(2019, 2, 1, 0, 0, 0, 0, time.Local)}, func(l *QueryLine) error {
+		ls = append(ls, l)
+		return nil
+	})
+	if len(ls) != 1 || !ls[0].Time.Equal(time.Date(2019, 2, 2, 10, 0, 0, 0, time.Local)) {
+		t.Fatal(ls)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package logger
+
+// handleReopenSignal windows不支持SIGHUP和SIGUSR1，需要直接调用Reopen
+func (o *DefaultWriter) handleReopenSignal() {}
@@ -0,0 +1,66 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package logger
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// go test -run TestReopen -v -count=1
+func TestReopen(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+
+	w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: "api", FixedName: true}).(*DefaultWriter)
+	l := NewLogger(w)
+	file := filepath.Join(dir, "app", "api.log")
+	l.Log1Warn("before rotate")
+
+	// 模拟logrotate移动日志文件
+	os.Rename(file, file+".1")
+	l.Log1Warn("still old file")
+	if err := w.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	l.Log1Warn("after reopen")
+
+	old, _ := ioutil.ReadFile(file + ".1")
+	cur, _ := ioutil.ReadFile(file)
+	if !strings.Contains(string(old), "before rotate") || !strings.Contains(string(old), "still old file") || strings.Contains(string(old), "after reopen") {
+		t.Fatal(string(old))
+	}
+	if !strings.Contains(string(cur), "after reopen") || strings.Contains(string(cur), "before rotate") {
+		t.Fatal(string(cur))
+	}
+}
+
+func TestReopenSignal(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+
+	w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Name: "api", FixedName: true, ReopenSignal: true})
+	l := NewLogger(w)
+	file := filepath.Join(dir, "api.log")
+	l.Log1Warn("before rotate")
+	os.Rename(file, file+".1")
+
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(file); err == nil {
+			break
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	l.Log1Warn("after signal")
+	cur, err := ioutil.ReadFile(file)
+	if err != nil || !strings.Contains(string(cur), "after signal") {
+		t.Fatal(err, string(cur))
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package logger
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleReopenSignal 收到SIGHUP或SIGUSR1时重新打开日志文件
+func (o *DefaultWriter) handleReopenSignal() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP, syscall.SIGUSR1)
+	go func() {
+		for range c {
+			if err := o.Reopen(); err != nil {
+				o.handleError(ErrorKindRotation, err)
+			}
+		}
+	}()
+}
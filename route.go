@@ -0,0 +1,117 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"sync"
+
+	"github.com/ohko/logger/parser"
+)
+
+// Encoder 把Logger的一条日志转换为Sink的输出格式
+type Encoder interface {
+	Encode(level int, p []byte) ([]byte, error)
+}
+
+// EncoderFunc ...
+type EncoderFunc func(level int, p []byte) ([]byte, error)
+
+// Encode ...
+func (f EncoderFunc) Encode(level int, p []byte) ([]byte, error) {
+	return f(level, p)
+}
+
+// ...
+var (
+	// TextEncoder 原样输出，Sink.Encoder为nil时使用
+	TextEncoder Encoder = EncoderFunc(func(level int, p []byte) ([]byte, error) {
+		return p, nil
+	})
+
+	// PlainEncoder 去掉颜色后输出，用于同时输出到终端和文件
+	PlainEncoder Encoder = EncoderFunc(func(level int, p []byte) ([]byte, error) {
+		return []byte(parser.StripColor(string(p))), nil
+	})
+
+	// JSONEncoder 输出为一行ConvertRecord格式的JSON
+	JSONEncoder Encoder = EncoderFunc(func(level int, p []byte) ([]byte, error) {
+		e := newSinkEntry(p)
+		e.Level = level
+		bs, err := json.Marshal(NewConvertRecord(NewQueryLine("", "", e.Entry)))
+		if err != nil {
+			return nil, err
+		}
+		return append(bs, '\n'), nil
+	})
+)
+
+// Sink 按日志等级路由的输出，接收 MinLevel <= level <= MaxLevel 的日志
+// 例如 {LoggerLevel2Error, LoggerLevel3Fatal, os.Stderr, nil} 只输出错误和严重信息
+type Sink struct {
+	MinLevel int       // 最小日志等级，包含
+	MaxLevel int       // 最大日志等级，包含
+	Writer   io.Writer // 输出
+	Encoder  Encoder   // 输出格式，默认TextEncoder
+}
+
+// router Logger和Fork共享的Sink列表
+type router struct {
+	lock  sync.Mutex
+	sinks []*Sink
+}
+
+func (o *router) set(sinks []*Sink) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.sinks = sinks
+}
+
+func (o *router) add(sink *Sink) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.sinks = append(o.sinks[:len(o.sinks):len(o.sinks)], sink)
+}
+
+func (o *router) enabled() bool {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return len(o.sinks) > 0
+}
+
+// write 把一条日志写入等级范围内的Sink，同一时间只有一条日志在写入
+// 一个Sink失败不影响其它Sink，返回所有Sink的错误
+func (o *router) write(level int, p []byte) (errs []error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for _, s := range o.sinks {
+		if level < s.MinLevel || level > s.MaxLevel || s.Writer == nil {
+			continue
+		}
+		enc := s.Encoder
+		if enc == nil {
+			enc = TextEncoder
+		}
+		bs, err := enc.Encode(level, p)
+		if err == nil {
+			_, err = s.Writer.Write(bs)
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// entryFormatter 使用log.Logger格式化日志，得到与SetOutput输出相同的内容
+type entryFormatter struct {
+	buf bytes.Buffer
+	l   *log.Logger
+}
+
+var formatterPool = sync.Pool{New: func() interface{} {
+	f := &entryFormatter{}
+	f.l = log.New(&f.buf, "", 0)
+	return f
+}}
@@ -0,0 +1,56 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// go test -run TestSinks -v -count=1
+func TestSinks(t *testing.T) {
+	main, all, errs, debug, js := &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}, &bytes.Buffer{}
+	l := NewLogger(main)
+	l.SetLevel(LoggerLevel0Debug)
+	l.SetColor(true)
+	l.SetPrefix("api")
+	l.SetSinks(
+		&Sink{MinLevel: LoggerLevel1Warning, MaxLevel: LoggerLevel3Fatal, Writer: all, Encoder: PlainEncoder},
+		&Sink{MinLevel: LoggerLevel2Error, MaxLevel: LoggerLevel3Fatal, Writer: errs},
+		&Sink{MinLevel: LoggerLevel0Debug, MaxLevel: LoggerLevel0Debug, Writer: debug},
+	)
+	l.AddSink(&Sink{MinLevel: LoggerLevel2Error, MaxLevel: LoggerLevel2Error, Writer: js, Encoder: JSONEncoder})
+
+	l.Log0Debug("debug")
+	l.Log1Warn("warning")
+	l.Log2Error("error")
+	l.Fork("fork").Log4Trace("trace")
+
+	if main.Len() != 0 {
+		t.Fatal(main.String())
+	}
+	if s := all.String(); strings.Count(s, "\n") != 2 || !strings.Contains(s, "[api:W]warning") || !strings.Contains(s, "[api:E]error") || strings.Contains(s, "\033") {
+		t.Fatal(s)
+	}
+	if s := errs.String(); strings.Count(s, "\n") != 1 || !strings.Contains(s, "\033[31m[api:E] \033[merror") || !strings.Contains(s, "route_test.go:") {
+		t.Fatal(s)
+	}
+	if s := debug.String(); strings.Count(s, "\n") != 1 || !strings.Contains(s, "debug") {
+		t.Fatal(s)
+	}
+
+	var r ConvertRecord
+	if err := json.Unmarshal(js.Bytes(), &r); err != nil {
+		t.Fatal(err, js.String())
+	}
+	if r.Level != "error" || r.Prefix != "api" || r.Message != "error" || r.Time == nil || !strings.HasSuffix(r.Caller, "route_test.go") {
+		t.Fatal(js.String())
+	}
+
+	// 清除Sink后恢复使用SetOutput的输出
+	l.SetSinks()
+	l.Log1Warn("main")
+	if !strings.Contains(main.String(), "main") {
+		t.Fatal(main.String())
+	}
+}
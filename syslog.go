@@ -0,0 +1,220 @@
+package logger
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ohko/logger/parser"
+)
+
+// ...
+const (
+	SyslogRFC5424 = "rfc5424" // <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+	SyslogRFC3164 = "rfc3164" // <PRI>Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG
+)
+
+// syslog severity
+const (
+	syslogCrit    = 2
+	syslogErr     = 3
+	syslogWarning = 4
+	syslogNotice  = 5
+	syslogInfo    = 6
+	syslogDebug   = 7
+)
+
+// SyslogSeverity 日志等级对应的syslog severity
+func SyslogSeverity(level int) int {
+	switch level {
+	case LoggerLevel0Debug:
+		return syslogDebug
+	case LoggerLevel1Warning:
+		return syslogWarning
+	case LoggerLevel2Error:
+		return syslogErr
+	case LoggerLevel3Fatal:
+		return syslogCrit
+	case LoggerLevel4Trace:
+		return syslogInfo
+	}
+	return syslogNotice
+}
+
+// SyslogWriterOption ...
+type SyslogWriterOption struct {
+	Network   string        // 网络类型 [udp|tcp|tls|unix|unixgram]，默认unixgram
+	Addr      string        // 服务器地址，unix/unixgram默认/dev/log
+	TLSConfig *tls.Config   // tls连接的配置
+	Format    string        // 日志格式 [rfc5424|rfc3164]，默认rfc5424
+	Facility  int           // syslog facility，默认1(user)
+	Hostname  string        // 主机名，默认os.Hostname()
+	AppName   string        // 日志前缀为空时使用的app-name，默认为进程名
+	Timeout   time.Duration // 连接和写超时，默认5秒
+	MaxDelay  time.Duration // 重连的最大间隔，默认1分钟
+}
+
+// SyslogWriter 把Logger的日志发送到syslog服务器
+// 日志前缀作为app-name，日志等级转换为syslog severity
+// TCP/TLS/unix使用octet-counting分帧，连接断开后按指数退避重连
+type SyslogWriter struct {
+	option *SyslogWriterOption
+	lock   sync.Mutex
+	conn   net.Conn
+	stream bool
+	pid    int
+
+	delay     time.Duration
+	nextRetry time.Time
+}
+
+// NewSyslogWriter ...
+func NewSyslogWriter(option *SyslogWriterOption) *SyslogWriter {
+	o := &SyslogWriter{option: option, pid: os.Getpid()}
+	if o.option == nil {
+		o.option = &SyslogWriterOption{}
+	}
+	if o.option.Network == "" {
+		o.option.Network = "unixgram"
+	}
+	if o.option.Addr == "" && strings.HasPrefix(o.option.Network, "unix") {
+		o.option.Addr = "/dev/log"
+	}
+	if o.option.Format == "" {
+		o.option.Format = SyslogRFC5424
+	}
+	if o.option.Facility <= 0 {
+		o.option.Facility = 1
+	}
+	if o.option.Hostname == "" {
+		o.option.Hostname, _ = os.Hostname()
+	}
+	if o.option.AppName == "" {
+		o.option.AppName = filepath.Base(os.Args[0])
+	}
+	if o.option.Timeout <= 0 {
+		o.option.Timeout = time.Second * 5
+	}
+	if o.option.MaxDelay <= 0 {
+		o.option.MaxDelay = time.Minute
+	}
+	o.stream = o.option.Network != "udp" && o.option.Network != "unixgram"
+	return o
+}
+
+func (o *SyslogWriter) connect() error {
+	if o.conn != nil {
+		return nil
+	}
+	if time.Now().Before(o.nextRetry) {
+		return errors.New("syslog: waiting to reconnect")
+	}
+
+	var conn net.Conn
+	var err error
+	d := &net.Dialer{Timeout: o.option.Timeout}
+	if o.option.Network == "tls" {
+		conn, err = tls.DialWithDialer(d, "tcp", o.option.Addr, o.option.TLSConfig)
+	} else {
+		conn, err = d.Dial(o.option.Network, o.option.Addr)
+	}
+	if err != nil {
+		// 指数退避重连
+		if o.delay == 0 {
+			o.delay = time.Second
+		} else if o.delay *= 2; o.delay > o.option.MaxDelay {
+			o.delay = o.option.MaxDelay
+		}
+		o.nextRetry = time.Now().Add(o.delay)
+		return err
+	}
+	o.conn, o.delay, o.nextRetry = conn, 0, time.Time{}
+	return nil
+}
+
+// Write 每次Write是一条Logger日志
+func (o *SyslogWriter) Write(p []byte) (n int, err error) {
+	msg := o.format(string(p))
+	if o.stream {
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	// 写失败时重连重试一次
+	for i := 0; i < 2; i++ {
+		if err = o.connect(); err != nil {
+			return 0, err
+		}
+		o.conn.SetWriteDeadline(time.Now().Add(o.option.Timeout))
+		if _, err = o.conn.Write([]byte(msg)); err == nil {
+			return len(p), nil
+		}
+		o.conn.Close()
+		o.conn = nil
+	}
+	return 0, err
+}
+
+// Close ...
+func (o *SyslogWriter) Close() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.conn == nil {
+		return nil
+	}
+	err := o.conn.Close()
+	o.conn = nil
+	return err
+}
+
+func (o *SyslogWriter) format(text string) string {
+	e, err := parser.ParseLine(text)
+	if err != nil {
+		e = &parser.Entry{Level: parser.LevelNormal, Message: parser.StripColor(strings.TrimSuffix(text, "\n"))}
+	}
+	t := e.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	app := syslogName(e.Prefix, 48)
+	if app == "" {
+		app = syslogName(o.option.AppName, 48)
+	}
+	msg := e.Message
+	if e.Caller != "" {
+		msg = e.Caller + ":" + strconv.Itoa(e.Line) + ": " + msg
+	}
+	pri := o.option.Facility*8 + SyslogSeverity(e.Level)
+	host := syslogName(o.option.Hostname, 255)
+	if host == "" {
+		host = "-"
+	}
+
+	if o.option.Format == SyslogRFC3164 {
+		return fmt.Sprintf("<%d>%s %s %s[%d]: %s", pri, t.Format(time.Stamp), host, app, o.pid, msg)
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d - - %s", pri, t.Format("2006-01-02T15:04:05.000000Z07:00"), host, app, o.pid, msg)
+}
+
+// syslogName 去掉空格等不可见字符，限制长度
+func syslogName(s string, max int) string {
+	s = strings.Map(func(r rune) rune {
+		if r <= 32 || r >= 127 {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > max {
+		s = s[:max]
+	}
+	return s
+}
@@ -0,0 +1,88 @@
+package logger
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// go test -run TestSyslog -v -count=1
+func TestSyslogUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	w := NewSyslogWriter(&SyslogWriterOption{Network: "udp", Addr: pc.LocalAddr().String(), Format: SyslogRFC3164, Hostname: "host", Facility: 16})
+	defer w.Close()
+	l := NewLogger(w)
+	l.SetPrefix("api")
+	l.Log2Error("boom")
+
+	buf := make([]byte, 1024)
+	n, _, err := pc.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := string(buf[:n])
+	// local0.err = 16*8+3
+	if !strings.HasPrefix(msg, "<131>") || !strings.Contains(msg, " host api[") || !strings.Contains(msg, "syslog_test.go:") || !strings.HasSuffix(msg, ": boom") {
+		t.Fatal(msg)
+	}
+}
+
+func TestSyslogTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	msgs := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			s, err := r.ReadString(' ')
+			if err != nil {
+				conn.Close()
+				continue
+			}
+			size, _ := strconv.Atoi(strings.TrimSpace(s))
+			buf := make([]byte, size)
+			r.Read(buf)
+			msgs <- string(buf)
+			// 收到一条日志后断开连接，测试重连
+			conn.Close()
+		}
+	}()
+
+	w := NewSyslogWriter(&SyslogWriterOption{Network: "tcp", Addr: ln.Addr().String(), Hostname: "host"})
+	defer w.Close()
+	l := NewLogger(w)
+	l.SetFlags(0)
+	l.Log0Debug("multi\nline")
+	if msg := <-msgs; !strings.HasPrefix(msg, "<15>1 ") || !strings.Contains(msg, " host logger.test ") || !strings.HasSuffix(msg, " - - multi\nline") {
+		t.Fatalf("%q", msg)
+	}
+
+	// 服务器已断开连接，写入时自动重连
+	for i := 0; i < 5; i++ {
+		l.Log1Warn("again")
+		select {
+		case msg := <-msgs:
+			if !strings.HasPrefix(msg, "<12>1 ") {
+				t.Fatalf("%q", msg)
+			}
+			return
+		case <-time.After(time.Millisecond * 200):
+		}
+	}
+	t.Fatal("not reconnected")
+}
@@ -0,0 +1,199 @@
+package logger
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultPathTemplate 默认的日志文件路径模板，与原来的 Path/Label/2006/01/Name2006-01-02.log 相同
+const DefaultPathTemplate = "{label}/{2006}/{01}/{name}{2006-01-02}.log"
+
+// 路径模板中的变量，其它{}中的内容作为time.Format的格式
+const (
+	templateLabel = "label" // 日志标签
+	templateName  = "name"  // 日志文件名
+	templateHost  = "host"  // 主机名
+	templatePID   = "pid"   // 进程ID
+	templateSeq   = "seq"   // 同一周期内按MaxSize切割的序号，从0开始
+)
+
+// templatePart 模板中的一段，key为空时是普通文本
+type templatePart struct {
+	text   string
+	key    string
+	layout bool // key是时间格式
+}
+
+// pathTemplate 以/分隔的路径模板，每个目录一组templatePart
+type pathTemplate struct {
+	dirs [][]templatePart
+}
+
+// templateValues 渲染模板时的变量值
+type templateValues struct {
+	label string
+	name  string
+	host  string
+	pid   int
+	seq   int
+}
+
+// parsePathTemplate 解析路径模板，例如 {label}/{host}/{2006-01-02}/{name}.{seq}.log
+func parsePathTemplate(s string) (*pathTemplate, error) {
+	if s == "" {
+		return nil, errors.New("path template: empty")
+	}
+	t := &pathTemplate{}
+	var dir []templatePart
+	text := ""
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '{':
+			end := strings.IndexByte(s[i:], '}')
+			if end < 0 {
+				return nil, errors.New("path template: unclosed { in " + s)
+			}
+			key := s[i+1 : i+end]
+			if key == "" {
+				return nil, errors.New("path template: empty {} in " + s)
+			}
+			if text != "" {
+				dir = append(dir, templatePart{text: text})
+				text = ""
+			}
+			switch key {
+			case templateLabel, templateName, templateHost, templatePID, templateSeq:
+				dir = append(dir, templatePart{key: key})
+			default:
+				dir = append(dir, templatePart{key: key, layout: true})
+			}
+			i += end
+		case '}':
+			return nil, errors.New("path template: unexpected } in " + s)
+		case '/':
+			if text != "" {
+				dir = append(dir, templatePart{text: text})
+				text = ""
+			}
+			if len(dir) > 0 {
+				t.dirs = append(t.dirs, dir)
+			}
+			dir = nil
+		default:
+			text += s[i : i+1]
+		}
+	}
+	if text != "" {
+		dir = append(dir, templatePart{text: text})
+	}
+	if len(dir) == 0 {
+		return nil, errors.New("path template: missing file name in " + s)
+	}
+	t.dirs = append(t.dirs, dir)
+	return t, nil
+}
+
+// has 模板中是否包含变量key
+func (t *pathTemplate) has(key string) bool {
+	for _, dir := range t.dirs {
+		for _, p := range dir {
+			if p.key == key {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// render 渲染模板，返回以/分隔的相对路径
+// glob为true时{seq}和{pid}渲染为*，其它内容转义，用于filepath.Glob查找一个周期内的所有文件
+func (t *pathTemplate) render(v *templateValues, tm time.Time, glob bool) string {
+	return t.renderDirs(t.dirs, v, tm, glob)
+}
+
+func (t *pathTemplate) renderDirs(dirs [][]templatePart, v *templateValues, tm time.Time, glob bool) string {
+	ss := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		s := ""
+		for _, p := range dir {
+			if glob && (p.key == templateSeq || p.key == templatePID) {
+				s += "*"
+				continue
+			}
+			var value string
+			switch {
+			case p.key == "":
+				value = p.text
+			case p.layout:
+				value = tm.Format(p.key)
+			case p.key == templateLabel:
+				value = v.label
+			case p.key == templateName:
+				value = v.name
+			case p.key == templateHost:
+				value = v.host
+			case p.key == templatePID:
+				value = strconv.Itoa(v.pid)
+			case p.key == templateSeq:
+				value = strconv.Itoa(v.seq)
+			}
+			if glob {
+				value = escapeGlob(value)
+			}
+			s += value
+		}
+		// {label}为空时不产生空目录
+		if s != "" {
+			ss = append(ss, s)
+		}
+	}
+	return strings.Join(ss, "/")
+}
+
+// archiveDir 按月压缩时压缩文件所在的目录
+// 为最后一个包含时间格式的目录的上级目录，默认模板为 {label}/{2006}，{label}/{name}{2006-01-02}.log为{label}
+func (t *pathTemplate) archiveDir(v *templateValues, tm time.Time) string {
+	// 目录中没有时间格式时为日志文件所在的目录
+	n := len(t.dirs) - 1
+	for i, dir := range t.dirs[:len(t.dirs)-1] {
+		for _, p := range dir {
+			if p.layout {
+				n = i
+			}
+		}
+	}
+	return t.renderDirs(t.dirs[:n], v, tm, false)
+}
+
+// daily 检查模板每天渲染为不同的路径，并且同一天内不变
+// 否则按日切割后继续写入原来的文件，压缩时会匹配到正在写入的日志文件
+func (t *pathTemplate) daily() error {
+	v := &templateValues{}
+	day := time.Date(2019, 1, 2, 0, 0, 0, 0, time.UTC)
+	s := t.render(v, day, false)
+	if t.render(v, day.Add(24*time.Hour-time.Second), false) != s {
+		return errors.New("path template: must not change within a day")
+	}
+	for _, d := range []time.Time{day.AddDate(0, 0, 1), day.AddDate(0, 0, 7), day.AddDate(0, 1, 0), day.AddDate(1, 0, 0)} {
+		if t.render(v, d, false) == s {
+			return errors.New("path template: must contain the year, month and day, such as {2006-01-02}")
+		}
+	}
+	return nil
+}
+
+// escapeGlob 转义filepath.Match的特殊字符
+func escapeGlob(s string) string {
+	if !strings.ContainsAny(s, `*?[\`) {
+		return s
+	}
+	// windows下\是路径分隔符，不能转义，使用[]转义
+	r := strings.NewReplacer("*", "[*]", "?", "[?]", "[", "[[]", `\`, `[\\]`)
+	if filepath.Separator == '\\' {
+		r = strings.NewReplacer("*", "[*]", "?", "[?]", "[", "[[]")
+	}
+	return r.Replace(s)
+}
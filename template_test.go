@@ -0,0 +1,273 @@
+package logger
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ohko/logger/clock/clocktest"
+)
+
+// go test -run TestPathTemplate -v -count=1
+func TestPathTemplate(t *testing.T) {
+	tm := time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)
+	v := &templateValues{label: "app", name: "api", host: "web1", pid: 42, seq: 3}
+	for _, c := range []struct{ tpl, file, glob, archive string }{
+		{DefaultPathTemplate, "app/2019/01/api2019-01-02.log", "app/2019/01/api2019-01-02.log", "app/2019"},
+		{"{label}/{host}/{2006-01-02}/{name}.{seq}.log", "app/web1/2019-01-02/api.3.log", "app/web1/2019-01-02/api.*.log", "app/web1"},
+		{"{name}-{pid}-{20060102}.log", "api-42-20190102.log", "api-*-20190102.log", ""},
+		{"{label}/{name}{2006-01-02}.log", "app/api2019-01-02.log", "app/api2019-01-02.log", "app"},
+	} {
+		tpl, err := parsePathTemplate(c.tpl)
+		if err != nil {
+			t.Fatal(c.tpl, err)
+		}
+		if s := tpl.render(v, tm, false); s != c.file {
+			t.Fatal(c.tpl, s)
+		}
+		if s := tpl.render(v, tm, true); s != c.glob {
+			t.Fatal(c.tpl, s)
+		}
+		if s := tpl.archiveDir(v, tm); s != c.archive {
+			t.Fatal(c.tpl, s)
+		}
+	}
+
+	// Label为空时不产生空目录
+	tpl, _ := parsePathTemplate(DefaultPathTemplate)
+	if s := tpl.render(&templateValues{name: "api"}, tm, false); s != "2019/01/api2019-01-02.log" {
+		t.Fatal(s)
+	}
+	// 文件名中的通配符需要转义
+	if s := tpl.render(&templateValues{name: "a*"}, tm, true); s != "2019/01/a[*]2019-01-02.log" {
+		t.Fatal(s)
+	}
+
+	for _, s := range []string{"", "{label", "label}", "{}/a.log", "{label}/"} {
+		if _, err := parsePathTemplate(s); err == nil {
+			t.Fatal(s)
+		}
+	}
+
+	// 每天一个文件，不能缺少年月日，也不能同一天内变化
+	for _, s := range []string{"{label}/{name}.log", "{name}{2006-01}.log", "{01}/{name}{02}.log", "{name}{Mon}.log", "{name}{2006-002}-{15}.log"} {
+		if tpl, _ := parsePathTemplate(s); tpl.daily() == nil {
+			t.Fatal(s)
+		}
+	}
+	for _, s := range []string{DefaultPathTemplate, "{label}/{name}{2006-01-02}.log", "{name}{2006-002}.log", "{06}/{Jan}/{name}{_2}.{seq}.log"} {
+		if tpl, _ := parsePathTemplate(s); tpl.daily() != nil {
+			t.Fatal(s)
+		}
+	}
+}
+
+// go test -run TestTemplateDaily -v -count=1
+func TestTemplateDaily(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+
+	// 不是每天一个文件的模板使用DefaultPathTemplate
+	var errs []*LoggerError
+	w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: "api", Template: "{label}/{name}.log", NoCurrentLink: true, ErrorHandler: func(e *LoggerError) {
+		errs = append(errs, e)
+	}}).(*DefaultWriter)
+	if w.option.Template != DefaultPathTemplate || len(errs) != 1 || errs[0].Kind != ErrorKindOpen {
+		t.Fatal(w.option.Template, errs)
+	}
+
+	// 固定文件名模式不使用模板
+	w = NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: "api", Template: "{label}/{name}.log", FixedName: true}).(*DefaultWriter)
+	if w.option.Template != "{label}/{name}.log" {
+		t.Fatal(w.option.Template)
+	}
+}
+
+// go test -run TestMonthArchiveMerge -v -count=1
+func TestMonthArchiveMerge(t *testing.T) {
+	for _, kp := range []KeyProvider{nil, testKeys} {
+		dir, _ := ioutil.TempDir("", "logger")
+		defer os.RemoveAll(dir)
+
+		// 同一个Label的多个Name按月压缩到同一个压缩文件
+		month := time.Date(2019, 1, 15, 12, 0, 0, 0, time.Local)
+		var archive string
+		for _, name := range []string{"a_", "b_"} {
+			w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: name, Template: "{label}/{name}{2006-01-02}.log", NoCurrentLink: true, ArchiveKeys: kp}).(*DefaultWriter)
+			ioutil.WriteFile(filepath.Join(dir, "app", name+"2019-01-01.log"), []byte(name), 0644)
+			archive = w.monthArchive(month, w.archiveExt())
+			if filepath.Dir(archive) != filepath.Join(dir, "app") {
+				t.Fatal(archive)
+			}
+			if err := compressAndRemoveFiles(w.monthFiles(month), archive, kp); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		zr, c, err := openArchiveWith(archive, kp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for _, f := range zr.File {
+			names = append(names, f.Name)
+		}
+		c.Close()
+		if strings.Join(names, ",") != "a_2019-01-01.log,b_2019-01-01.log" {
+			t.Fatal(names)
+		}
+		SetArchiveKeys(kp)
+		result, err := VerifyArchives(dir)
+		SetArchiveKeys(nil)
+		if err != nil || len(result) != 1 || result[0].Err != nil {
+			t.Fatal(result, err)
+		}
+		if files, _ := filepath.Glob(filepath.Join(dir, "app", ".*.tmp*")); len(files) != 0 {
+			t.Fatal(files)
+		}
+
+		// 同名的文件已经在压缩文件中时不覆盖
+		ioutil.WriteFile(filepath.Join(dir, "app", "a_2019-01-01.log"), []byte("again"), 0644)
+		if err := compressAndRemoveFiles([]string{filepath.Join(dir, "app", "a_2019-01-01.log")}, archive, kp); err == nil {
+			t.Fatal("overwrite")
+		}
+		if _, err := os.Stat(archive); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// go test -run TestTemplateMaxSize -v -count=1
+func TestTemplateMaxSize(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+
+	tpl := "{label}/{2006-01-02}/{name}.{seq}.log"
+	w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: "api", Template: tpl, MaxSize: 10}).(*DefaultWriter)
+	for _, s := range []string{"12345\n", "12345\n", "12345\n"} {
+		w.Write([]byte(s))
+	}
+	day := filepath.Join(dir, "app", time.Now().Format("2006-01-02"))
+	for i, want := range []string{"12345\n", "12345\n", "12345\n"} {
+		bs, err := ioutil.ReadFile(filepath.Join(day, "api."+string('0'+rune(i))+".log"))
+		if err != nil || string(bs) != want {
+			t.Fatal(i, string(bs), err)
+		}
+	}
+	if target, _ := os.Readlink(filepath.Join(dir, "app", "current.log")); target != time.Now().Format("2006-01-02")+"/api.2.log" {
+		t.Fatal(target)
+	}
+
+	// 重新打开时从已有的最大序号继续
+	w2 := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: "api", Template: tpl, MaxSize: 10, NoCurrentLink: true}).(*DefaultWriter)
+	if w2.seq != 2 {
+		t.Fatal(w2.seq)
+	}
+}
+
+// go test -run TestTemplateCompress -v -count=1
+func TestTemplateCompress(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+
+	w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: "api", Template: "{label}/{host}/{2006-01-02}/{name}.{seq}.log", NoCurrentLink: true}).(*DefaultWriter)
+	host := filepath.Join(dir, "app", w.host)
+	for _, f := range []string{"2019-01-01/api.0.log", "2019-01-01/api.1.log", "2019-01-31/api.0.log", "2019-02-01/api.0.log"} {
+		os.MkdirAll(filepath.Dir(filepath.Join(host, f)), 0755)
+		ioutil.WriteFile(filepath.Join(host, f), []byte(f), 0644)
+	}
+
+	// 按日压缩每个序号的文件
+	day := time.Date(2019, 2, 1, 12, 0, 0, 0, time.Local)
+	if files := w.dayFiles(day, ""); len(files) != 1 {
+		t.Fatal(files)
+	}
+	if err := compressAndRemoveFile(filepath.Join(host, "2019-02-01/api.0.log"), filepath.Join(host, "2019-02-01/api.0.zip")); err != nil {
+		t.Fatal(err)
+	}
+	if files := w.dayFiles(day, ".zip"); len(files) != 1 {
+		t.Fatal(files)
+	}
+
+	// 按月压缩到模板中日期目录的上级目录
+	month := time.Date(2019, 1, 15, 12, 0, 0, 0, time.Local)
+	files := w.monthFiles(month)
+	archive := w.monthArchive(month, ".zip")
+	if len(files) != 3 || archive != filepath.Join(host, "2019-01.zip") {
+		t.Fatal(files, archive)
+	}
+	if err := compressAndRemoveFiles(files, archive, nil); err != nil {
+		t.Fatal(err)
+	}
+	r, err := zip.OpenReader(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var names []string
+	for _, f := range r.File {
+		names = append(names, f.Name)
+	}
+	if strings.Join(names, ",") != "2019-01-01/api.0.log,2019-01-01/api.1.log,2019-01-31/api.0.log" {
+		t.Fatal(names)
+	}
+	// 删除日志文件和空目录
+	if _, err := os.Stat(filepath.Join(host, "2019-01-01")); !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(host, "2019-02-01")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// go test -run TestTemplateDayArchive -v -count=1
+func TestTemplateDayArchive(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+	os.MkdirAll(dir+"/app", 0755)
+	ioutil.WriteFile(dir+"/app/api-2019.02.08.zip", nil, 0644)
+	ioutil.WriteFile(dir+"/app/api-2019.02.09.zip", nil, 0644)
+
+	// 文件名不以.log结尾时，日期中的.02不是扩展名
+	c := clocktest.New(time.Date(2019, 2, 10, 23, 59, 0, 0, time.UTC))
+	w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: "api", Template: "{label}/{name}-{2006.01.02}", CompressMode: ModeDay, CompressCount: 1, CompressKeep: 1, Location: time.UTC, Clock: c})
+	w.Write([]byte("day 10\n"))
+
+	c.BlockUntil(1)
+	c.Add(time.Minute)
+	c.BlockUntil(2)
+	c.Add(time.Minute)
+	waitFor(t, "day archive", func() bool {
+		return exists(dir+"/app/api-2019.02.10.zip") && !exists(dir+"/app/api-2019.02.10") && !exists(dir+"/app/api-2019.02.08.zip")
+	})
+	if !exists(dir+"/app/api-2019.02.09.zip") || !exists(dir+"/app/api-2019.02.11") {
+		t.Fatal("removed too much")
+	}
+}
+
+// go test -run TestTemplateWithoutLabel -v -count=1
+func TestTemplateWithoutLabel(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "logger")
+	defer os.RemoveAll(dir)
+
+	// 模板中没有{label}时也在Path/Label下创建锁和CurrentLink
+	var errs []*LoggerError
+	w := NewDefaultWriter(&DefaultWriterOption{Path: dir, Label: "app", Name: "api", Template: "{name}/{2006-01-02}.log", ErrorHandler: func(err *LoggerError) { errs = append(errs, err) }}).(*DefaultWriter)
+	w.Write([]byte("hello\n"))
+	if len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	bs, err := ioutil.ReadFile(filepath.Join(dir, "app", "current.log"))
+	if err != nil || !strings.Contains(string(bs), "hello") {
+		t.Fatal(string(bs), err)
+	}
+	unlock, ok := w.lockDir()
+	if !ok {
+		t.Fatal("lock failed")
+	}
+	unlock()
+}
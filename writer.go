@@ -2,12 +2,17 @@ package logger
 
 import (
 	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io"
-	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
+
+	"github.com/ohko/logger/clock"
 )
 
 // ...
@@ -18,21 +23,56 @@ const (
 
 // DefaultWriter ...
 type DefaultWriter struct {
+	lock       sync.Mutex
 	fileHandle io.Writer
 	lastHandle *os.File
+	clone      *FanoutWriter
+
+	state          string
+	retryAt        time.Time
+	fallbackHandle *os.File
+	fallbackFailed bool
+	ring           *memoryRing
+	pending        []deferredError
+
+	audit *auditChain
+
+	tpl  *pathTemplate
+	host string
+	seq  int   // 当前日志文件的{seq}
+	size int64 // 当前日志文件的大小
 
 	option *DefaultWriterOption
 }
 
 // DefaultWriterOption ...
 type DefaultWriterOption struct {
-	CompressMode  string    // 日志压缩模式 [month|day] month=按月压缩，day=按日压缩
-	CompressCount int       // 仅在按日压缩模式下有效，设置为压缩几天前的日志，支持大于等于1的数字
-	CompressKeep  int       // 前多少次的压缩文件删除掉，支持month和day模式。默认为0，不删除。例如：1=保留最近1个压缩日志，2=保留最近2个压缩日志，依次类推。。。
-	Clone         io.Writer // 日志克隆输出接口
-	Path          string    // 日志目录，默认目录：./log
-	Label         string    // 日志标签
-	Name          string    // 日志文件名
+	CompressMode  string              // 日志压缩模式 [month|day] month=按月压缩，day=按日压缩
+	CompressCount int                 // 仅在按日压缩模式下有效，设置为压缩几天前的日志，支持大于等于1的数字
+	CompressKeep  int                 // 前多少次的压缩文件删除掉，支持month和day模式。默认为0，不删除。例如：1=保留最近1个压缩日志，2=保留最近2个压缩日志，依次类推。。。
+	Clone         io.Writer           // 日志克隆输出接口
+	CloneOption   *FanoutWriterOption // Clone失败的处理，Clone失败不影响写日志文件，OnError为nil时通过ErrorHandler回调
+	Path          string              // 日志目录，默认目录：./log
+	Label         string              // 日志标签
+	Name          string              // 日志文件名
+	Template      string              // 日志文件路径模板，相对Path，默认DefaultPathTemplate，支持{label}{name}{host}{pid}{seq}和时间格式如{2006-01-02}，必须包含年月日，不正确时使用DefaultPathTemplate
+	MaxSize       int64               // 日志文件超过多少字节后{seq}加1切换到新文件，需要模板中包含{seq}，默认0不切割
+	Location      *time.Location      // 按日切割、文件名中的日期、压缩和删除过期日志使用的时区，默认time.Local
+	Clock         clock.Clock         // 时间来源，默认clock.Real，测试时使用clocktest.Clock
+	FixedName     bool                // 固定文件名模式，日志文件为 Path/Label/Name.log，不按日期切割和压缩，由logrotate等外部工具切割
+	ReopenSignal  bool                // 收到SIGHUP或SIGUSR1时重新打开日志文件，windows不支持
+	CurrentLink   string              // Path/Label中指向当前日志文件的符号链接，默认current.log
+	NoCurrentLink bool                // 不创建CurrentLink，固定文件名模式不创建
+	ErrorHandler  ErrorHandler        // 打开、切换、压缩和删除日志失败的回调，默认输出到os.Stderr
+	ArchiveKeys   KeyProvider         // 设置后压缩文件使用AES-GCM加密，文件名为.zip.enc，读取时使用SetArchiveKeys设置密钥
+	Audit         bool                // 审计日志模式，每条日志增加链式哈希，切换日志文件时链头写入新文件，使用VerifyAudit校验，同一个Label只能有一个审计日志的DefaultWriter，其它的写入备用输出
+	AuditKey      []byte              // 审计日志的HMAC-SHA256密钥，为空时使用SHA-256
+
+	// 日志目录不可用(磁盘满、没有权限等)时依次使用FallbackPath、os.Stderr和内存环形缓存
+	FallbackPath     string        // 备用日志目录，为空时不使用
+	NoStderrFallback bool          // 不使用os.Stderr作为备用输出
+	RingSize         int           // 内存环形缓存的大小，默认1MB
+	RetryInterval    time.Duration // 降级后重试日志目录的间隔，默认1分钟
 }
 
 // NewDefaultWriter ...
@@ -47,6 +87,35 @@ func NewDefaultWriter(option *DefaultWriterOption) io.Writer {
 	if o.option.Label != "" {
 		o.option.Label = "/" + o.option.Label
 	}
+	if o.option.Template == "" {
+		o.option.Template = DefaultPathTemplate
+	}
+	tpl, err := parsePathTemplate(o.option.Template)
+	if err == nil && !o.option.FixedName {
+		err = tpl.daily()
+	}
+	if err != nil {
+		o.handleError(ErrorKindOpen, err)
+		o.option.Template = DefaultPathTemplate
+		tpl, _ = parsePathTemplate(o.option.Template)
+	}
+	o.tpl = tpl
+	if o.option.FixedName || !o.tpl.has(templateSeq) {
+		o.option.MaxSize = 0
+	}
+	o.host, _ = os.Hostname()
+	if o.option.Clock == nil {
+		o.option.Clock = clock.Real
+	}
+	if o.option.Location == nil {
+		o.option.Location = time.Local
+	}
+	if o.option.CurrentLink == "" {
+		o.option.CurrentLink = "current.log"
+	}
+	if o.option.FixedName && o.option.Name == "" {
+		o.option.Name = filepath.Base(os.Args[0])
+	}
 	if o.option.CompressCount <= 1 {
 		o.option.CompressCount = 1
 	}
@@ -56,62 +125,356 @@ func NewDefaultWriter(option *DefaultWriterOption) io.Writer {
 	if o.option.CompressMode == ModeDay {
 		o.option.CompressKeep += o.option.CompressCount
 	}
-	o.next()
+	if o.option.RingSize <= 0 {
+		o.option.RingSize = 1024 * 1024
+	}
+	if o.option.RetryInterval <= 0 {
+		o.option.RetryInterval = time.Minute
+	}
+	if o.option.Clone != nil {
+		// 没有设置OnError时Clone失败通过ErrorHandler回调
+		cloneOption := FanoutWriterOption{}
+		if o.option.CloneOption != nil {
+			cloneOption = *o.option.CloneOption
+		}
+		if cloneOption.OnError == nil {
+			cloneOption.OnError = func(err error) { o.handleError(ErrorKindWrite, err) }
+		}
+		o.clone = NewFanoutWriter(&cloneOption, o.option.Clone)
+	}
+	if o.option.Audit {
+		o.audit = &auditChain{key: o.option.AuditKey}
+	}
+	o.state = WriterStatePrimary
+	o.ring = &memoryRing{size: o.option.RingSize}
+	if err := o.next(); err != nil {
+		o.handleError(ErrorKindOpen, err)
+	}
+	if o.option.ReopenSignal {
+		o.handleReopenSignal()
+	}
 
-	go o.backend()
+	// 固定文件名模式不切割和压缩
+	if !o.option.FixedName {
+		go o.backend()
+	}
 
 	return o
 }
 
-func (o *DefaultWriter) next() {
-	f := o.option.Path + o.option.Label + time.Now().Format("/2006/01/") + o.option.Name + time.Now().Format("2006-01-02") + ".log"
+// logFile 今天的日志文件
+func (o *DefaultWriter) logFile(path string) string {
+	if o.option.FixedName {
+		return path + o.option.Label + "/" + o.option.Name + ".log"
+	}
+	return filepath.Join(path, o.tpl.render(o.templateValues(o.seq), o.now(), false))
+}
+
+// now Location时区的当前时间
+func (o *DefaultWriter) now() time.Time {
+	return o.option.Clock.Now().In(o.option.Location)
+}
+
+// nextDay t的第二天0点，夏令时没有0点时为当天的第一个时刻
+func nextDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	next := time.Date(y, m, d+1, 0, 0, 0, 0, t.Location())
+	// 0点不存在时time.Date可能返回前一天，逐分钟找到第二天的第一个时刻
+	_, _, nd := time.Date(y, m, d+1, 12, 0, 0, 0, t.Location()).Date()
+	for next.Day() != nd {
+		next = next.Add(time.Minute)
+	}
+	return next
+}
+
+// daysBefore t的n天前的中午，按日历天计算，不受夏令时一天23或25小时的影响
+func daysBefore(t time.Time, n int) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d-n, 12, 0, 0, 0, t.Location())
+}
+
+// templateValues 渲染路径模板的变量
+func (o *DefaultWriter) templateValues(seq int) *templateValues {
+	return &templateValues{
+		label: strings.TrimPrefix(o.option.Label, "/"),
+		name:  o.option.Name,
+		host:  o.host,
+		pid:   os.Getpid(),
+		seq:   seq,
+	}
+}
+
+// dayFiles t这一天所有{seq}和{pid}的日志文件
+func (o *DefaultWriter) dayFiles(t time.Time, ext string) []string {
+	pattern := filepath.Join(o.option.Path, o.tpl.render(o.templateValues(0), t, true))
+	if ext != "" {
+		pattern = dayArchive(pattern, ext)
+	}
+	files, _ := filepath.Glob(pattern)
+	return files
+}
+
+// monthFiles t所在月份所有的日志文件
+func (o *DefaultWriter) monthFiles(t time.Time) []string {
+	var files []string
+	seen := map[string]bool{}
+	// 使用中午避免夏令时切换
+	day := time.Date(t.Year(), t.Month(), 1, 12, 0, 0, 0, t.Location())
+	for ; day.Month() == t.Month(); day = day.AddDate(0, 0, 1) {
+		for _, f := range o.dayFiles(day, "") {
+			if !seen[f] && !isArchive(f) {
+				seen[f] = true
+				files = append(files, f)
+			}
+		}
+	}
+	return files
+}
+
+// dayArchive 按日压缩时日志文件的压缩文件，去掉.log后加上ext
+// 文件名不以.log结尾时直接加上ext，{name}-{2006.01.02}的扩展名是日期的一部分
+func dayArchive(logFile, ext string) string {
+	return strings.TrimSuffix(logFile, ".log") + ext
+}
+
+// monthArchive t所在月份的压缩文件，默认为 Path/Label/2006/2006-01.zip
+func (o *DefaultWriter) monthArchive(t time.Time, ext string) string {
+	return filepath.Join(o.option.Path, o.tpl.archiveDir(o.templateValues(0), t), t.Format("2006-01")+ext)
+}
+
+// archiveExt 新的压缩文件的扩展名，加密时为.zip.enc
+func (o *DefaultWriter) archiveExt() string {
+	if o.option.ArchiveKeys != nil {
+		return ".zip" + EncryptedExt
+	}
+	return ".zip"
+}
+
+// openLogFile 以O_APPEND打开日志文件，每条日志一次Write，多个进程追加写入时不会交错
+// 打开后加共享锁，压缩时等待所有进程关闭该文件
+func openLogFile(f string) (*os.File, error) {
 	os.MkdirAll(filepath.Dir(f), 0755)
 	nc, err := os.OpenFile(f, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
 	if err != nil {
-		log.Println(err)
+		return nil, err
+	}
+	lockShared(nc)
+	return nc, nil
+}
+
+// labelDir Path/Label目录，保存.logger.lock、.logger.audit和CurrentLink
+// 模板中没有{label}时日志文件不在这个目录下，需要先创建
+func (o *DefaultWriter) labelDir() string {
+	dir := o.option.Path + o.option.Label
+	os.MkdirAll(dir, 0755)
+	return dir
+}
+
+// lockDir 对 Path/Label/.logger.lock 加排他锁，其它DefaultWriter正在压缩时等待
+// 多个进程或同一个Label的多个Name依次压缩和删除过期日志，已经被其它进程压缩的文件会跳过
+func (o *DefaultWriter) lockDir() (unlock func(), ok bool) {
+	f, err := os.OpenFile(o.labelDir()+"/.logger.lock", os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		o.handleError(ErrorKindCompression, err)
+		return nil, false
+	}
+	if err := lockExclusive(f); err != nil {
+		f.Close()
+		o.handleError(ErrorKindCompression, err)
+		return nil, false
+	}
+	return func() { f.Close() }, true
+}
+
+func (o *DefaultWriter) next() error {
+	o.lock.Lock()
+	// 备用文件也按日期切换
+	if o.fallbackHandle != nil {
+		o.fallbackHandle.Close()
+		o.fallbackHandle = nil
+	}
+	err := o.open()
+	o.lock.Unlock()
+	o.flushErrors()
+	return err
+}
+
+// open 打开当前的日志文件，{seq}从这个周期已有的最大序号继续，需要持有锁
+func (o *DefaultWriter) open() error {
+	if !o.option.FixedName && o.tpl.has(templateSeq) {
+		o.seq = 0
+		for {
+			o.seq++
+			if _, err := os.Stat(o.logFile(o.option.Path)); err != nil {
+				o.seq--
+				break
+			}
+		}
+	}
+	if err := o.openAudit(); err != nil {
+		o.degrade()
+		return err
+	}
+	f := o.logFile(o.option.Path)
+	nc, err := openLogFile(f)
+	if err != nil {
+		o.degrade()
+		return err
+	}
+	o.setHandle(nc)
+	o.startAudit(nc)
+	o.updateLink(f)
+	if o.state != WriterStatePrimary {
+		o.recover()
+	}
+	return nil
+}
+
+// rotateSize 日志文件超过MaxSize后{seq}加1切换到新文件，需要持有锁
+func (o *DefaultWriter) rotateSize() {
+	o.seq++
+	f := o.logFile(o.option.Path)
+	nc, err := openLogFile(f)
+	if err != nil {
+		// 继续写入原来的文件
+		o.seq--
+		o.deferError(ErrorKindRotation, err)
 		return
 	}
+	o.setHandle(nc)
+	o.startAudit(nc)
+	o.updateLink(f)
+}
 
+// openAudit 审计日志模式下打开.logger.audit并读取链头，需要持有锁
+// 同一个Label已经有其它DefaultWriter在写审计链时返回错误，降级到备用输出，不向审计链的目录写入没有哈希的日志，
+// 每RetryInterval重试，其它DefaultWriter退出后继续审计链
+func (o *DefaultWriter) openAudit() error {
+	if o.audit == nil || o.audit.state != nil {
+		return nil
+	}
+	state, head, err := openAuditState(o.labelDir())
+	if err != nil {
+		return err
+	}
+	o.audit.state, o.audit.head = state, head
+	return nil
+}
+
+// startAudit 审计日志模式下继续审计链，需要持有锁
+// 已有的日志文件不为空时从它的最后一行继续，新文件的第一行写入链头
+func (o *DefaultWriter) startAudit(nc *os.File) {
+	if o.audit == nil {
+		return
+	}
+	if o.size > 0 {
+		if head := lastAuditHead(nc.Name()); head != nil {
+			o.audit.head = head
+		}
+		return
+	}
+	n, err := nc.Write(o.audit.marker())
+	o.size += int64(n)
+	if err != nil {
+		o.deferError(ErrorKindWrite, err)
+	}
+}
+
+// updateLink 更新CurrentLink，需要持有锁
+func (o *DefaultWriter) updateLink(f string) {
+	if o.option.FixedName || o.option.NoCurrentLink {
+		return
+	}
+	if err := updateLink(f, o.labelDir()+"/"+o.option.CurrentLink); err != nil {
+		o.deferError(ErrorKindRotation, err)
+	}
+}
+
+// updateLink 使用相对路径创建临时符号链接后rename，原子地替换link
+func updateLink(file, link string) error {
+	target, err := filepath.Rel(filepath.Dir(link), file)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(filepath.Dir(link), "."+filepath.Base(link)+".tmp")
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Reopen 重新打开日志文件，用于logrotate移动日志文件后
+// 在锁内替换文件句柄，不会丢失正在写入的日志
+func (o *DefaultWriter) Reopen() error {
+	return o.next()
+}
+
+func (o *DefaultWriter) setHandle(nc *os.File) {
 	// 一分钟后关闭文件句柄
 	if o.lastHandle != nil {
 		oldnc := o.lastHandle
 		go func(f *os.File) {
-			time.Sleep(time.Minute)
+			o.option.Clock.Sleep(time.Minute)
 			f.Close()
 		}(oldnc)
 	}
 
 	// 设置新文件句柄
 	o.lastHandle = nc
-	if o.option.Clone != nil {
-		o.fileHandle = io.MultiWriter(nc, o.option.Clone)
-	} else {
-		o.fileHandle = nc
+	o.fileHandle = nc
+	o.size = 0
+	if fi, err := nc.Stat(); err == nil {
+		o.size = fi.Size()
+	}
+}
+
+// handleError 错误中的路径来自*os.PathError
+func (o *DefaultWriter) handleError(kind ErrorKind, err error) {
+	path := ""
+	if e, ok := err.(*os.PathError); ok {
+		path = e.Path
 	}
+	handleError(o.option.ErrorHandler, kind, path, err)
 }
 
 func (o *DefaultWriter) backend() {
 	for {
-		// 等待明天
-		t1 := time.Now()
-		t2, _ := time.Parse("2006-01-02 -0700", t1.Add(time.Hour*24).Format("2006-01-02 -0700"))
-		<-time.After(t2.Sub(t1))
+		// 等待明天，按Location时区的日期计算
+		t1 := o.now()
+		t2 := nextDay(t1)
+		<-o.option.Clock.After(t2.Sub(t1))
 
 		// 下一个日志文件
-		o.next()
+		if err := o.next(); err != nil {
+			o.handleError(ErrorKindRotation, err)
+		}
 
 		// 每个月的第一天压缩上个月日志
-		if o.option.CompressMode == ModeMonth && time.Now().Format("02 15:04") == "01 00:00" {
+		if o.option.CompressMode == ModeMonth && t2.Day() == 1 {
 			go func() {
-				if err := compressAndRemoveDir(o.option.Path+o.option.Label+t1.Format("/2006/01/"), o.option.Path+o.option.Label+t1.Format("/2006/2006-01.zip")); err != nil {
-					log.Println(err)
+				unlock, ok := o.lockDir()
+				if !ok {
+					return
 				}
+				defer unlock()
 
-				// 删除过期日志
+				if err := compressAndRemoveFiles(o.monthFiles(t1), o.monthArchive(t1, o.archiveExt()), o.option.ArchiveKeys); err != nil {
+					o.handleError(ErrorKindCompression, err)
+				}
+
+				// 删除过期日志，subMoth(t2, 1)是刚压缩的上个月
+				// 开启或关闭加密前的压缩文件也要删除
 				if o.option.CompressKeep > 0 {
-					zipFile := o.option.Path + o.option.Label + subMoth(time.Now(), o.option.CompressKeep).Format("/2006/2006-01.zip")
-					if err := os.RemoveAll(zipFile); err != nil {
-						log.Println(err)
+					for _, ext := range []string{".zip", ".zip" + EncryptedExt} {
+						zipFile := o.monthArchive(subMoth(t2, o.option.CompressKeep), ext)
+						if err := removeArchive(zipFile); err != nil {
+							o.handleError(ErrorKindRetention, err)
+						}
 					}
 				}
 			}()
@@ -120,19 +483,32 @@ func (o *DefaultWriter) backend() {
 		// 压缩几天前的日志
 		if o.option.CompressMode == ModeDay && o.option.CompressCount >= 1 {
 			go func() {
-				t := time.Now().Add(-time.Hour * time.Duration(24*o.option.CompressCount))
-				logFile := o.option.Path + o.option.Label + t.Format("/2006/01/") + o.option.Name + t.Format("2006-01-02.log")
-				zipFile := o.option.Path + o.option.Label + t.Format("/2006/01/") + o.option.Name + t.Format("2006-01-02.zip")
-				if err := compressAndRemoveFile(logFile, zipFile); err != nil {
-					log.Println(err)
+				unlock, ok := o.lockDir()
+				if !ok {
+					return
+				}
+				defer unlock()
+
+				// 每个{seq}和{pid}的文件分别压缩为同名的zip文件
+				t := daysBefore(t2, o.option.CompressCount)
+				for _, logFile := range o.dayFiles(t, "") {
+					if isArchive(logFile) {
+						continue
+					}
+					zipFile := dayArchive(logFile, o.archiveExt())
+					if err := compressAndRemoveFiles([]string{logFile}, zipFile, o.option.ArchiveKeys); err != nil {
+						o.handleError(ErrorKindCompression, err)
+					}
 				}
 
 				// 删除过期日志
 				if o.option.CompressKeep > 0 {
-					t := time.Now().Add(-time.Hour * time.Duration(24*(o.option.CompressKeep+1)))
-					zipFile := o.option.Path + o.option.Label + t.Format("/2006/01/") + o.option.Name + t.Format("2006-01-02.zip")
-					if err := os.RemoveAll(zipFile); err != nil {
-						log.Println(err)
+					t := daysBefore(t2, o.option.CompressKeep+1)
+					zipFiles := append(o.dayFiles(t, ".zip"), o.dayFiles(t, ".zip"+EncryptedExt)...)
+					for _, zipFile := range zipFiles {
+						if err := removeArchive(zipFile); err != nil {
+							o.handleError(ErrorKindRetention, err)
+						}
 					}
 				}
 			}()
@@ -141,91 +517,237 @@ func (o *DefaultWriter) backend() {
 }
 
 func (o *DefaultWriter) Write(p []byte) (n int, err error) {
-	if o.fileHandle == nil {
-		return 0, errors.New("io nil error")
+	o.lock.Lock()
+	if o.state != WriterStatePrimary && !o.option.Clock.Now().Before(o.retryAt) {
+		o.retry()
+	}
+	if o.state == WriterStatePrimary && o.option.MaxSize > 0 && o.size > 0 && o.size+int64(len(p)) > o.option.MaxSize {
+		o.rotateSize()
+	}
+	if o.state == WriterStatePrimary {
+		// 审计日志模式下写入增加了哈希的日志，写入成功后才更新链头
+		data, head := p, []byte(nil)
+		if o.audit != nil {
+			data, head = o.audit.seal(p)
+		}
+		if o.fileHandle == nil {
+			err = errors.New("io nil error")
+		} else if n, err = o.fileHandle.Write(data); err != nil {
+			o.deferError(ErrorKindWrite, err)
+		}
+		o.size += int64(n)
+		if err != nil {
+			o.degrade()
+		} else if o.audit != nil {
+			if e := o.audit.commit(head); e != nil {
+				o.deferError(ErrorKindWrite, e)
+			}
+		}
+	}
+	if o.state != WriterStatePrimary {
+		n, err = o.writeFallback(p)
+	}
+	if err == nil {
+		n = len(p)
+	}
+	pending := len(o.pending) > 0
+	o.lock.Unlock()
+	if pending {
+		o.flushErrors()
+	}
+
+	// 日志文件和Clone互不影响，只返回日志文件的错误
+	if o.clone != nil {
+		o.clone.Write(p)
 	}
-	return o.fileHandle.Write(p)
+	return n, err
 }
 
+// compressAndRemoveDir 日志目录不存在时说明其它进程已经压缩过
 func compressAndRemoveDir(dir, zipFile string) error {
-	fz, err := os.Create(zipFile)
-	if err != nil {
-		return err
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
 	}
-	defer fz.Close()
-
-	w := zip.NewWriter(fz)
-	defer w.Close()
-
+	var files []string
 	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if info != nil && !info.IsDir() {
-			fDest, err := w.Create(info.Name())
-			if err != nil {
-				return err
-			}
-			fSrc, err := os.Open(path)
-			if err != nil {
-				return err
-			}
-			defer fSrc.Close()
-			_, err = io.Copy(fDest, fSrc)
-			if err != nil {
-				return err
-			}
+			files = append(files, path)
 		}
 		return nil
 	}); err != nil {
 		return err
 	}
+	if err := compressAndRemoveFiles(files, zipFile, nil); err != nil {
+		return err
+	}
 
 	// 删除上个月的日志目录
 	return os.RemoveAll(dir)
 }
 
-func compressAndRemoveFile(file, zipFile string) error {
-	fz, err := os.Create(zipFile)
-	if err != nil {
-		return err
+// compressAndRemoveFiles 把多个日志文件压缩到一个zip文件，压缩文件中的路径相对于这些文件共同的目录
+// 文件不存在时说明其它进程已经压缩过，校验压缩文件并写入SHA256SUMS后才删除日志文件和zip文件所在目录下的空目录
+// zipFile已经存在时(同一个Label的多个Name按月压缩)合并原来的文件，先写入临时文件，校验后替换zipFile
+// kp不为nil时加密后写入zipFile，也使用kp读取已经存在的zipFile
+func compressAndRemoveFiles(files []string, zipFile string, kp KeyProvider) error {
+	var exist []string
+	for _, f := range files {
+		if _, err := os.Stat(f); err == nil {
+			exist = append(exist, f)
+		}
+	}
+	if len(exist) == 0 {
+		return nil
+	}
+	files = exist
+	base := filepath.Dir(files[0])
+	for _, f := range files[1:] {
+		for base != "." && base != string(filepath.Separator) && !strings.HasPrefix(f, base+string(filepath.Separator)) {
+			base = filepath.Dir(base)
+		}
 	}
-	defer fz.Close()
 
-	w := zip.NewWriter(fz)
-	defer w.Close()
+	var old *zip.Reader
+	if _, err := os.Lstat(zipFile); err == nil {
+		zr, c, err := openArchiveWith(zipFile, kp)
+		if err != nil {
+			return err
+		}
+		defer c.Close()
+		old = zr
+	}
 
-	fDest, err := w.Create(filepath.Base(file))
+	sums := map[string]string{}
+	plain := filepath.Join(filepath.Dir(zipFile), "."+filepath.Base(zipFile)+".tmp")
+	tmp := plain
+	if kp != nil {
+		tmp = plain + EncryptedExt
+	}
+	err := writeZip(plain, old, files, base, sums)
+	if err == nil {
+		err = verifyZip(plain, nil, sums)
+	}
+	if err == nil && kp != nil {
+		if err = encryptFile(plain, tmp, kp); err == nil {
+			err = verifyZip(tmp, kp, sums)
+		}
+		os.Remove(plain)
+	}
+	if err == nil {
+		err = os.Rename(tmp, zipFile)
+	}
 	if err != nil {
+		os.Remove(plain)
+		os.Remove(tmp)
 		return err
 	}
-	fSrc, err := os.Open(file)
-	if err != nil {
+	if err := addManifest(zipFile); err != nil {
 		return err
 	}
-	defer fSrc.Close()
-	_, err = io.Copy(fDest, fSrc)
+
+	// 删除日志文件和空目录
+	stop := filepath.Dir(zipFile) + string(filepath.Separator)
+	for _, f := range files {
+		if err := os.Remove(f); err != nil {
+			return err
+		}
+		for dir := filepath.Dir(f); strings.HasPrefix(dir, stop); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// writeZip 写入压缩文件，先复制old中原来的文件，sums记录每个文件内容的SHA-256
+func writeZip(zipFile string, old *zip.Reader, files []string, base string, sums map[string]string) error {
+	os.MkdirAll(filepath.Dir(zipFile), 0755)
+	fz, err := os.Create(zipFile)
 	if err != nil {
 		return err
 	}
-
-	// 删除日志文件
-	return os.RemoveAll(file)
+	w := zip.NewWriter(fz)
+	if old != nil {
+		for _, f := range old.File {
+			sum, err := copyZipFile(w, f)
+			if err != nil {
+				fz.Close()
+				return err
+			}
+			sums[f.Name] = sum
+		}
+	}
+	for _, f := range files {
+		name, sum, err := addZipFile(w, f, base)
+		if err == nil && sums[name] != "" {
+			err = errors.New(zipFile + ": " + name + " already exists")
+		}
+		if err != nil {
+			fz.Close()
+			return err
+		}
+		sums[name] = sum
+	}
+	if err := w.Close(); err != nil {
+		fz.Close()
+		return err
+	}
+	return fz.Close()
 }
 
-// 返回几个月前的第一天时间
-func subMoth(t time.Time, c int) time.Time {
+// copyZipFile 复制已有压缩文件中的一个文件，返回SHA-256
+func copyZipFile(w *zip.Writer, f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	fDest, err := w.CreateHeader(&zip.FileHeader{Name: f.Name, Method: zip.Deflate, Modified: f.Modified})
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(fDest, h), rc); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
 
-	if c == 0 {
-		t, _ = time.Parse("2006-01 -0700", t.Format("2006-01 -0700"))
-		return t
+// addZipFile 等待所有写日志的进程关闭文件后写入压缩文件，返回压缩文件中的路径和SHA-256
+func addZipFile(w *zip.Writer, file, base string) (string, string, error) {
+	fSrc, err := os.Open(file)
+	if err != nil {
+		return "", "", err
+	}
+	defer fSrc.Close()
+	if err := lockExclusive(fSrc); err != nil {
+		return "", "", err
 	}
 
-	for i := 0; i < c; i++ {
-		// 这个月的第一天
-		t, _ = time.Parse("2006-01 -0700", t.Format("2006-01 -0700"))
-		// 减一小时
-		t = t.Add(-time.Hour)
-		// 上个月的第一天
-		t, _ = time.Parse("2006-01 -0700", t.Format("2006-01 -0700"))
+	name, err := filepath.Rel(base, file)
+	if err != nil {
+		name = filepath.Base(file)
+	}
+	name = filepath.ToSlash(name)
+	fDest, err := w.Create(name)
+	if err != nil {
+		return "", "", err
 	}
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(fDest, h), fSrc); err != nil {
+		return "", "", err
+	}
+	return name, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// compressAndRemoveFile 日志文件不存在时说明其它进程已经压缩过
+// 压缩前等待所有写日志的进程关闭该文件
+func compressAndRemoveFile(file, zipFile string) error {
+	return compressAndRemoveFiles([]string{file}, zipFile, nil)
+}
 
-	return t
+// 返回几个月前的第一天时间，使用t的时区
+func subMoth(t time.Time, c int) time.Time {
+	return time.Date(t.Year(), t.Month()-time.Month(c), 1, 0, 0, 0, 0, t.Location())
 }